@@ -0,0 +1,227 @@
+package yocto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SumType is an algebraic data type declared by
+// (deftype shape (circle r) (rect w h)).
+type SumType struct {
+	name     Name
+	variants []*Variant
+}
+
+func (t *SumType) Evaluate(env *Environment) (Expression, error) {
+	return t, nil
+}
+
+func (t *SumType) String() string {
+	parts := []string{"#<type", t.name.String()}
+	for _, v := range t.variants {
+		parts = append(parts, Write(v.declaration()))
+	}
+	return strings.Join(parts, " ") + ">"
+}
+
+// Variant is one constructor of a SumType. Calling it builds a
+// VariantValue. A variant declared as a bare name has no fields and is
+// bound directly to its single value.
+type Variant struct {
+	typ    *SumType
+	name   Name
+	fields []Name
+	bare   bool
+}
+
+func (v *Variant) Evaluate(env *Environment) (Expression, error) {
+	return v, nil
+}
+
+func (v *Variant) String() string {
+	return fmt.Sprintf("#<variant %v/%v>", v.typ.name, v.name)
+}
+
+func (v *Variant) New(values []Expression) (*VariantValue, error) {
+	if len(values) != len(v.fields) {
+		return nil, fmt.Errorf("%v requires %d arguments, got %d", v.name, len(v.fields), len(values))
+	}
+	return &VariantValue{variant: v, values: append([]Expression(nil), values...)}, nil
+}
+
+// declaration returns the variant as written in deftype.
+func (v *Variant) declaration() Expression {
+	if v.bare {
+		return v.name
+	}
+	decl := List{v.name}
+	for _, field := range v.fields {
+		decl = append(decl, field)
+	}
+	return decl
+}
+
+// keywords returns the field names as the keywords a value of the variant
+// is written with, as in #circle{:r 1}.
+func (v *Variant) keywords() []*Keyword {
+	keys := make([]*Keyword, len(v.fields))
+	for i, field := range v.fields {
+		keys[i] = InternKeyword(field.String())
+	}
+	return keys
+}
+
+// VariantValue is an instance of a Variant. It prints as a literal like a
+// record's, #circle{:r 1} or #none{}, which the reader reads back.
+type VariantValue struct {
+	variant *Variant
+	values  []Expression
+}
+
+func (v *VariantValue) Evaluate(env *Environment) (Expression, error) {
+	return v, nil
+}
+
+func (v *VariantValue) String() string {
+	return Write(v)
+}
+
+// pattern matching ---
+
+var wildcard = Intern("_")
+
+// matchPattern matches value against pattern, adding variable bindings to
+// bindings. Patterns are _, a variable, a literal, a quoted form, a
+// vector of patterns, a bare variant or (variant pattern...).
+func matchPattern(pattern, value Expression, env *Environment, bindings map[Name]Expression) (bool, error) {
+	switch p := pattern.(type) {
+	case Name:
+		if p == wildcard {
+			return true, nil
+		}
+		if bound, ok := env.Get(p); ok {
+			if vv, ok := bound.(*VariantValue); ok && vv.variant.bare {
+				return Equal(vv, value), nil
+			}
+		}
+		bindings[p] = value
+		return true, nil
+	case List:
+		if len(p) == 2 && p[0] == Intern("quote") {
+			return Equal(p[1], value), nil
+		}
+		variant, err := patternVariant(p, env)
+		if err != nil {
+			return false, err
+		}
+		vv, ok := value.(*VariantValue)
+		if !ok || vv.variant != variant {
+			return false, nil
+		}
+		if len(p)-1 != len(variant.fields) {
+			return false, fmt.Errorf("pattern %v expects %d fields", p, len(variant.fields))
+		}
+		for i, sub := range p[1:] {
+			if ok, err := matchPattern(sub, vv.values[i], env, bindings); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case Vector:
+		v, ok := value.(Vector)
+		if !ok || v.Count() != p.Count() {
+			return false, nil
+		}
+		for i := 0; i < p.Count(); i++ {
+			if ok, err := matchPattern(p.Nth(i), v.Nth(i), env, bindings); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return Equal(pattern, value), nil
+}
+
+func patternVariant(p List, env *Environment) (*Variant, error) {
+	if len(p) > 0 {
+		if name, ok := p[0].(Name); ok {
+			if bound, ok := env.Get(name); ok {
+				if variant, ok := bound.(*Variant); ok {
+					return variant, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid pattern: %v", p)
+}
+
+// maxWarned is how many match forms checkExhaustive remembers having
+// warned about.
+const maxWarned = 1024
+
+// checkExhaustive warns, on the output of env, when the top-level patterns
+// of a match name variants of a sum type but leave some unhandled without
+// a catch-all. Each match form warns once, so a match in a loop is
+// reported a single time, within the last maxWarned forms warned about.
+func checkExhaustive(form *Expression, patterns []Expression, env *Environment) {
+	if env.state.warned[form] {
+		return
+	}
+	var typ *SumType
+	handled := make(map[*Variant]bool)
+	for _, pattern := range patterns {
+		var variant *Variant
+		switch p := pattern.(type) {
+		case Name:
+			bound, _ := env.Get(p)
+			vv, ok := bound.(*VariantValue)
+			if !ok || !vv.variant.bare {
+				return // a wildcard or variable matches everything
+			}
+			variant = vv.variant
+		case List:
+			variant, _ = patternVariant(p, env)
+			if variant != nil && !allCatchAll(p[1:], env) {
+				continue // only matches some values of the variant
+			}
+		}
+		if variant != nil {
+			typ = variant.typ
+			handled[variant] = true
+		}
+	}
+	if typ == nil {
+		return
+	}
+	var missing []string
+	for _, v := range typ.variants {
+		if !handled[v] {
+			missing = append(missing, v.name.String())
+		}
+	}
+	if len(missing) > 0 {
+		// Forgetting every form once there are maxWarned keeps an
+		// environment that evaluates generated code from growing without
+		// bound, at the cost of warning about some forms again.
+		if env.state.warned == nil || len(env.state.warned) >= maxWarned {
+			env.state.warned = make(map[*Expression]bool)
+		}
+		env.state.warned[form] = true
+		fmt.Fprintf(env.Output(), "warning: match on %v does not handle %s\n", typ.name, strings.Join(missing, ", "))
+	}
+}
+
+func allCatchAll(patterns []Expression, env *Environment) bool {
+	for _, pattern := range patterns {
+		name, ok := pattern.(Name)
+		if !ok {
+			return false
+		}
+		if bound, ok := env.Get(name); ok && name != wildcard {
+			if _, ok := bound.(*VariantValue); ok {
+				return false
+			}
+		}
+	}
+	return true
+}
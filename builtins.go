@@ -1,10 +1,29 @@
-package main
+package yocto
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+var builtins = map[Name]*Builtin{}
+
+// builtinGroups lists the builtins in each group, such as "strings" or
+// "io", so that a sandbox can bind only some of them.
+var builtinGroups = make(map[string][]Name)
+
+// defineBuiltin registers a Go function that is called with evaluated
+// arguments, as opposed to the special forms dispatched in List.Evaluate.
+func defineBuiltin(group, name string, fn func(args []Expression, env *Environment) (Expression, error)) {
+	builtins[Intern(name)] = &Builtin{name: name, fn: fn}
+	builtinGroups[group] = append(builtinGroups[group], Intern(name))
+}
+
 // core ----------------------------------------------------------------------------------
 
 func evalDef(args []Expression, env *Environment) (Expression, error) {
@@ -15,7 +34,7 @@ func evalDef(args []Expression, env *Environment) (Expression, error) {
 	if !ok {
 		return nil, fmt.Errorf("first argument to def must be a symbol")
 	}
-	value, err := args[1].Evaluate(env)
+	value, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
@@ -25,13 +44,13 @@ func evalDef(args []Expression, env *Environment) (Expression, error) {
 
 func evalPrint(args []Expression, env *Environment) (Expression, error) {
 	for _, arg := range args {
-		value, err := arg.Evaluate(env)
+		value, err := evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
-		fmt.Print(value)
+		fmt.Fprint(env.Output(), Display(value))
 	}
-	fmt.Println()
+	fmt.Fprintln(env.Output())
 	return nil, nil
 }
 
@@ -39,7 +58,7 @@ func evalDo(args []Expression, env *Environment) (Expression, error) {
 	var result Expression
 	var err error
 	for _, arg := range args {
-		result, err = arg.Evaluate(env)
+		result, err = evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
@@ -47,6 +66,34 @@ func evalDo(args []Expression, env *Environment) (Expression, error) {
 	return result, nil
 }
 
+// evalTry handles (try body... (catch e handler...)). If the body fails,
+// the handler is evaluated with e bound to the error instead. Interrupts
+// and exceeded limits are not caught.
+func evalTry(args []Expression, env *Environment) (Expression, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("try requires a catch clause")
+	}
+	clause, ok := args[len(args)-1].(List)
+	if !ok || len(clause) < 2 || clause[0] != Intern("catch") {
+		return nil, fmt.Errorf("try must end with (catch name body...)")
+	}
+	name, ok := clause[1].(Name)
+	if !ok {
+		return nil, fmt.Errorf("catch requires a symbol to bind the error to")
+	}
+	result, err := evalDo(args[:len(args)-1], env)
+	if err == nil || !env.catchable(err) {
+		return result, err
+	}
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		evalErr = &EvalError{Err: err}
+	}
+	catchEnv := NewEnvironment(env)
+	catchEnv.Set(name, evalErr)
+	return evalDo(clause[2:], catchEnv)
+}
+
 func evalQuote(args []Expression, env *Environment) (Expression, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("quote requires exactly one argument")
@@ -65,7 +112,7 @@ func evalUnquote(args []Expression, env *Environment) (Expression, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("unquote requires exactly one argument")
 	}
-	return args[0].Evaluate(env)
+	return evaluate(args[0], env)
 }
 
 func evalDefMacro(args []Expression, env *Environment) (Expression, error) {
@@ -86,7 +133,7 @@ func evalDefMacro(args []Expression, env *Environment) (Expression, error) {
 	params := make(List, 0)
 	var restParam Name
 	for i, param := range signature[1:] {
-		if paramName, ok := param.(Name); ok && string(paramName) == "&" {
+		if paramName, ok := param.(Name); ok && paramName.String() == "&" {
 			if i+1 < len(signature[1:]) {
 				restParam = signature[i+2].(Name)
 				break
@@ -113,7 +160,7 @@ func evalEval(args []Expression, env *Environment) (Expression, error) {
 	// Unwrap the quote if present
 	var exprToEval Expression
 	if list, ok := args[0].(List); ok && len(list) > 0 {
-		if name, ok := list[0].(Name); ok && (string(name) == "quote" || string(name) == "quasiquote") {
+		if name, ok := list[0].(Name); ok && (name.String() == "quote" || name.String() == "quasiquote") {
 			if len(list) != 2 {
 				return nil, fmt.Errorf("quote expects exactly one argument")
 			}
@@ -126,7 +173,7 @@ func evalEval(args []Expression, env *Environment) (Expression, error) {
 	}
 
 	// Evaluate the unwrapped expression
-	return exprToEval.Evaluate(env)
+	return evaluate(exprToEval, env)
 }
 
 func evalLambda(args []Expression, env *Environment) (Expression, error) {
@@ -156,23 +203,344 @@ func evalDefn(args []Expression, env *Environment) (Expression, error) {
 	}
 	params := signature[1:]
 	body := args[1:]
-	fn := &Function{params: params, body: body, env: env}
+	fn := &Function{name: name, params: params, body: body, env: env}
 	env.Set(name, fn)
 	return fn, nil
 }
 
+// evalDefRecord handles (defrecord point x y), binding the constructor
+// point, the predicate point?, an accessor point-x per field and the
+// updater (point-with p :x 1).
+func evalDefRecord(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("defrecord requires a name")
+	}
+	name, ok := args[0].(Name)
+	if !ok {
+		return nil, fmt.Errorf("record name must be a symbol")
+	}
+	typ := &RecordType{name: name}
+	for _, arg := range args[1:] {
+		field, ok := arg.(Name)
+		if !ok {
+			return nil, fmt.Errorf("record fields must be symbols, got %v", arg)
+		}
+		keyword := InternKeyword(field.String())
+		for _, earlier := range typ.fields {
+			if earlier == keyword {
+				return nil, fmt.Errorf("duplicate field %v in defrecord %v", field, name)
+			}
+		}
+		typ.fields = append(typ.fields, keyword)
+	}
+	bindRecordType(typ, env)
+	return typ, nil
+}
+
+// bindRecordType binds the constructor, predicate, accessors and updater
+// of typ that defrecord describes.
+func bindRecordType(typ *RecordType, env *Environment) {
+	name := typ.name
+	env.Set(name, typ)
+	env.Set(Intern(name.String()+"?"), &Builtin{
+		name: name.String() + "?",
+		fn: func(args []Expression, env *Environment) (Expression, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%v? requires exactly one argument", name)
+			}
+			r, ok := args[0].(*Record)
+			return Boolean(ok && r.typ == typ), nil
+		},
+	})
+	for _, field := range typ.fields {
+		field := field
+		accessor := name.String() + "-" + field.name
+		env.Set(Intern(accessor), &Builtin{
+			name: accessor,
+			fn: func(args []Expression, env *Environment) (Expression, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("%s requires exactly one argument", accessor)
+				}
+				r, ok := args[0].(*Record)
+				if !ok || r.typ != typ {
+					return nil, fmt.Errorf("%s expects a %v, got %v", accessor, name, args[0])
+				}
+				value, _ := r.Get(field)
+				return value, nil
+			},
+		})
+	}
+	updater := name.String() + "-with"
+	env.Set(Intern(updater), &Builtin{
+		name: updater,
+		fn: func(args []Expression, env *Environment) (Expression, error) {
+			if len(args) < 1 || len(args)%2 != 1 {
+				return nil, fmt.Errorf("%s requires a %v followed by field/value pairs", updater, name)
+			}
+			r, ok := args[0].(*Record)
+			if !ok || r.typ != typ {
+				return nil, fmt.Errorf("%s expects a %v, got %v", updater, name, args[0])
+			}
+			for i := 1; i < len(args); i += 2 {
+				var err error
+				if r, err = r.With(args[i], args[i+1]); err != nil {
+					return nil, err
+				}
+			}
+			return r, nil
+		},
+	})
+}
+
+// evalDefType handles (deftype shape (circle r) (rect w h) empty), binding
+// shape, a constructor and predicate (circle?) per variant, and bare
+// variants such as empty directly to their value.
+func evalDefType(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("deftype requires a name and at least one variant")
+	}
+	name, ok := args[0].(Name)
+	if !ok {
+		return nil, fmt.Errorf("type name must be a symbol")
+	}
+	typ := &SumType{name: name}
+	for _, arg := range args[1:] {
+		variant := &Variant{typ: typ}
+		switch decl := arg.(type) {
+		case Name:
+			variant.name, variant.bare = decl, true
+		case List:
+			if len(decl) == 0 {
+				return nil, fmt.Errorf("variant declaration must not be empty")
+			}
+			if variant.name, ok = decl[0].(Name); !ok {
+				return nil, fmt.Errorf("variant name must be a symbol")
+			}
+			for _, field := range decl[1:] {
+				fieldName, ok := field.(Name)
+				if !ok {
+					return nil, fmt.Errorf("variant fields must be symbols, got %v", field)
+				}
+				for _, earlier := range variant.fields {
+					if earlier == fieldName {
+						return nil, fmt.Errorf("duplicate field %v in variant %v", fieldName, variant.name)
+					}
+				}
+				variant.fields = append(variant.fields, fieldName)
+			}
+		default:
+			return nil, fmt.Errorf("invalid variant declaration: %v", arg)
+		}
+		typ.variants = append(typ.variants, variant)
+	}
+
+	env.Set(name, typ)
+	for _, variant := range typ.variants {
+		variant := variant
+		if variant.bare {
+			env.Set(variant.name, &VariantValue{variant: variant})
+		} else {
+			env.Set(variant.name, variant)
+		}
+		predicate := variant.name.String() + "?"
+		env.Set(Intern(predicate), &Builtin{
+			name: predicate,
+			fn: func(args []Expression, env *Environment) (Expression, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("%s requires exactly one argument", predicate)
+				}
+				vv, ok := args[0].(*VariantValue)
+				return Boolean(ok && vv.variant == variant), nil
+			},
+		})
+	}
+	return typ, nil
+}
+
+// evalMatch handles (match expr (pattern body...) ...), evaluating the body
+// of the first clause whose pattern matches with its variables bound.
+func evalMatch(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("match requires an expression and at least one clause")
+	}
+	value, err := evaluate(args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	clauses := make([]List, len(args)-1)
+	patterns := make([]Expression, len(clauses))
+	for i, arg := range args[1:] {
+		clause, ok := arg.(List)
+		if !ok || len(clause) < 1 {
+			return nil, fmt.Errorf("match clauses must be (pattern body...)")
+		}
+		clauses[i], patterns[i] = clause, clause[0]
+	}
+	checkExhaustive(&args[0], patterns, env)
+
+	for _, clause := range clauses {
+		bindings := make(map[Name]Expression)
+		ok, err := matchPattern(clause[0], value, env, bindings)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		clauseEnv := NewEnvironment(env)
+		for name, bound := range bindings {
+			clauseEnv.Set(name, bound)
+		}
+		return evalDo(clause[1:], clauseEnv)
+	}
+	return nil, fmt.Errorf("no match clause for %v", value)
+}
+
+// evalDefProtocol handles (defprotocol name (method this args...) ...).
+func evalDefProtocol(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("defprotocol requires a name and at least one method")
+	}
+	name, ok := args[0].(Name)
+	if !ok {
+		return nil, fmt.Errorf("protocol name must be a symbol")
+	}
+	protocol := &Protocol{name: name}
+	for _, arg := range args[1:] {
+		signature, ok := arg.(List)
+		if !ok || len(signature) < 2 {
+			return nil, fmt.Errorf("protocol methods must be lists of a name and at least one parameter")
+		}
+		methodName, ok := signature[0].(Name)
+		if !ok {
+			return nil, fmt.Errorf("protocol method name must be a symbol")
+		}
+		method := &ProtocolMethod{name: methodName, protocol: protocol, impls: make(map[interface{}]Expression)}
+		protocol.methods = append(protocol.methods, method)
+		env.Set(methodName, method)
+	}
+	env.Set(name, protocol)
+	return protocol, nil
+}
+
+// evalExtendType handles
+//
+//	(extend-type type protocol ((method this args...) body...) ... protocol ...)
+//
+// where type is a record or one of the built-in type names such as String.
+func evalExtendType(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("extend-type requires a type and a protocol")
+	}
+	typ, err := resolveType(args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	var protocol *Protocol
+	for _, arg := range args[1:] {
+		if name, ok := arg.(Name); ok {
+			value, found := env.Get(name)
+			if protocol, ok = value.(*Protocol); !found || !ok {
+				return nil, fmt.Errorf("%v is not a protocol", name)
+			}
+			continue
+		}
+		if protocol == nil {
+			return nil, fmt.Errorf("extend-type expects a protocol before its methods")
+		}
+		impl, ok := arg.(List)
+		if !ok || len(impl) < 2 {
+			return nil, fmt.Errorf("method implementations must be ((name params...) body...)")
+		}
+		signature, ok := impl[0].(List)
+		if !ok || len(signature) < 2 {
+			return nil, fmt.Errorf("method signature must contain the name and at least one parameter")
+		}
+		methodName, _ := signature[0].(Name)
+		method := protocol.method(methodName)
+		if method == nil {
+			return nil, fmt.Errorf("%v is not a method of protocol %v", signature[0], protocol.name)
+		}
+		method.extend(typ, &Function{params: signature[1:], body: impl[1:], env: env})
+	}
+	return nil, nil
+}
+
+// resolveType returns the typeKey of the type named by expr: a record or
+// sum type bound to it, or one of the built-in type names.
+func resolveType(expr Expression, env *Environment) (interface{}, error) {
+	name, ok := expr.(Name)
+	if !ok {
+		return nil, fmt.Errorf("type must be a symbol, got %v", expr)
+	}
+	if value, found := env.Get(name); found {
+		switch typ := value.(type) {
+		case *RecordType, *SumType:
+			return typ, nil
+		}
+	}
+	if builtinTypeNames[name.String()] {
+		return name.String(), nil
+	}
+	return nil, fmt.Errorf("unknown type: %v", name)
+}
+
+// evalDefMulti handles (defmulti name dispatch-fn).
+func evalDefMulti(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("defmulti requires a name and a dispatch function")
+	}
+	name, ok := args[0].(Name)
+	if !ok {
+		return nil, fmt.Errorf("multimethod name must be a symbol")
+	}
+	dispatch, err := evaluate(args[1], env)
+	if err != nil {
+		return nil, err
+	}
+	multi := &MultiFn{name: name, dispatch: dispatch}
+	env.Set(name, multi)
+	return multi, nil
+}
+
+// evalDefMethod handles (defmethod name dispatch-value (params...) body...).
+func evalDefMethod(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 4 {
+		return nil, fmt.Errorf("defmethod requires a name, a dispatch value, parameters and a body")
+	}
+	name, ok := args[0].(Name)
+	if !ok {
+		return nil, fmt.Errorf("multimethod name must be a symbol")
+	}
+	value, found := env.Get(name)
+	multi, ok := value.(*MultiFn)
+	if !found || !ok {
+		return nil, fmt.Errorf("%v is not a multimethod", name)
+	}
+	dispatchValue, err := evaluate(args[1], env)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := args[2].(List)
+	if !ok {
+		return nil, fmt.Errorf("defmethod parameters must be a list")
+	}
+	multi.addMethod(dispatchValue, &Function{params: params, body: args[3:], env: env})
+	return multi, nil
+}
+
 func evalIf(args []Expression, env *Environment) (Expression, error) {
 	if len(args) < 2 || len(args) > 3 {
 		return nil, fmt.Errorf("if requires 2 or 3 arguments")
 	}
-	condition, err := args[0].Evaluate(env)
+	condition, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 	if condition != nil && condition != Boolean(false) {
-		return args[1].Evaluate(env)
+		return evaluate(args[1], env)
 	} else if len(args) == 3 {
-		return args[2].Evaluate(env)
+		return evaluate(args[2], env)
 	}
 	return nil, nil
 }
@@ -186,7 +554,7 @@ func evalAnd(args []Expression, env *Environment) (Expression, error) {
 
 	var result Expression
 	for _, arg := range args {
-		evaluated, err := arg.Evaluate(env)
+		evaluated, err := evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
@@ -204,7 +572,7 @@ func evalOr(args []Expression, env *Environment) (Expression, error) {
 	}
 
 	for _, arg := range args {
-		evaluated, err := arg.Evaluate(env)
+		evaluated, err := evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
@@ -220,7 +588,7 @@ func evalNot(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("not requires exactly one argument")
 	}
 
-	value, err := args[0].Evaluate(env)
+	value, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
@@ -233,7 +601,7 @@ func evalNot(args []Expression, env *Environment) (Expression, error) {
 func evalAdd(args []Expression, env *Environment) (Expression, error) {
 	var result float64
 	for _, arg := range args {
-		value, err := arg.Evaluate(env)
+		value, err := evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
@@ -251,7 +619,7 @@ func evalSubtract(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("- requires at least one argument")
 	}
 
-	first, err := args[0].Evaluate(env)
+	first, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
@@ -267,7 +635,7 @@ func evalSubtract(args []Expression, env *Environment) (Expression, error) {
 
 	result := float64(firstNum)
 	for _, arg := range args[1:] {
-		value, err := arg.Evaluate(env)
+		value, err := evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
@@ -283,7 +651,7 @@ func evalSubtract(args []Expression, env *Environment) (Expression, error) {
 func evalMultiply(args []Expression, env *Environment) (Expression, error) {
 	result := 1.0
 	for _, arg := range args {
-		value, err := arg.Evaluate(env)
+		value, err := evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
@@ -301,7 +669,7 @@ func evalDivide(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("/ requires at least one argument")
 	}
 
-	first, err := args[0].Evaluate(env)
+	first, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
@@ -317,7 +685,7 @@ func evalDivide(args []Expression, env *Environment) (Expression, error) {
 
 	result := float64(firstNum)
 	for _, arg := range args[1:] {
-		value, err := arg.Evaluate(env)
+		value, err := evaluate(arg, env)
 		if err != nil {
 			return nil, err
 		}
@@ -338,12 +706,12 @@ func evalPower(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("** requires exactly two arguments")
 	}
 
-	base, err := args[0].Evaluate(env)
+	base, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 
-	exponent, err := args[1].Evaluate(env)
+	exponent, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
@@ -369,17 +737,17 @@ func evalEqual(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("= requires exactly two arguments")
 	}
 
-	left, err := args[0].Evaluate(env)
+	left, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := args[1].Evaluate(env)
+	right, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
 
-	return Boolean(left == right), nil
+	return Boolean(Equal(left, right)), nil
 }
 
 func evalNotEqual(args []Expression, env *Environment) (Expression, error) {
@@ -387,17 +755,17 @@ func evalNotEqual(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("!= requires exactly two arguments")
 	}
 
-	left, err := args[0].Evaluate(env)
+	left, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := args[1].Evaluate(env)
+	right, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
 
-	return Boolean(left != right), nil
+	return Boolean(!Equal(left, right)), nil
 }
 
 func evalLessThan(args []Expression, env *Environment) (Expression, error) {
@@ -405,12 +773,12 @@ func evalLessThan(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("< requires exactly two arguments")
 	}
 
-	left, err := args[0].Evaluate(env)
+	left, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := args[1].Evaluate(env)
+	right, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
@@ -430,12 +798,12 @@ func evalLessThanOrEqual(args []Expression, env *Environment) (Expression, error
 		return nil, fmt.Errorf("<= requires exactly two arguments")
 	}
 
-	left, err := args[0].Evaluate(env)
+	left, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := args[1].Evaluate(env)
+	right, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
@@ -455,12 +823,12 @@ func evalGreaterThan(args []Expression, env *Environment) (Expression, error) {
 		return nil, fmt.Errorf("> requires exactly two arguments")
 	}
 
-	left, err := args[0].Evaluate(env)
+	left, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := args[1].Evaluate(env)
+	right, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
@@ -480,12 +848,12 @@ func evalGreaterThanOrEqual(args []Expression, env *Environment) (Expression, er
 		return nil, fmt.Errorf(">= requires exactly two arguments")
 	}
 
-	left, err := args[0].Evaluate(env)
+	left, err := evaluate(args[0], env)
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := args[1].Evaluate(env)
+	right, err := evaluate(args[1], env)
 	if err != nil {
 		return nil, err
 	}
@@ -499,3 +867,1719 @@ func evalGreaterThanOrEqual(args []Expression, env *Environment) (Expression, er
 
 	return Boolean(leftNum >= rightNum), nil
 }
+
+// printing ------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("printing", "write", builtinWrite)
+	defineBuiltin("printing", "display", builtinDisplay)
+	defineBuiltin("printing", "repr", builtinRepr)
+	defineBuiltin("printing", "read-string", builtinReadString)
+	defineBuiltin("printing", "pprint", builtinPprint)
+}
+
+// builtinWrite prints values in readable form, separated by spaces.
+func builtinWrite(args []Expression, env *Environment) (Expression, error) {
+	for i, arg := range args {
+		if i > 0 {
+			fmt.Fprint(env.Output(), " ")
+		}
+		fmt.Fprint(env.Output(), Write(arg))
+	}
+	return nil, nil
+}
+
+func builtinDisplay(args []Expression, env *Environment) (Expression, error) {
+	for _, arg := range args {
+		fmt.Fprint(env.Output(), Display(arg))
+	}
+	return nil, nil
+}
+
+func builtinRepr(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("repr requires exactly one argument")
+	}
+	return String(Write(args[0])), nil
+}
+
+// builtinPprint prints a value across lines, within an optional width.
+func builtinPprint(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("pprint requires a value and an optional width")
+	}
+	width := DefaultWidth
+	if len(args) == 2 {
+		n, ok := toIndex(args[1])
+		if !ok || n < 1 {
+			return nil, fmt.Errorf("pprint width must be a positive integer")
+		}
+		width = n
+	}
+	fmt.Fprintln(env.Output(), Pprint(args[0], width))
+	return nil, nil
+}
+
+// builtinReadString parses the first form in a string without evaluating
+// it.
+func builtinReadString(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("read-string requires exactly one argument")
+	}
+	s, err := toString("read-string", args[0])
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := env.checkTokenNames(tokens); err != nil {
+		return nil, err
+	}
+	data, _, err := parseExpr(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return readLiterals(data, env)
+}
+
+// readLiterals replaces the record literals in data with the records and
+// variants they name, so that what write prints reads back as an equal
+// value. Field values are taken as read, without evaluating them.
+func readLiterals(data Expression, env *Environment) (Expression, error) {
+	switch e := data.(type) {
+	case RecordLiteral:
+		fields, err := readLiterals(e.fields, env)
+		if err != nil {
+			return nil, err
+		}
+		return e.build(fields.(Map), env)
+	case List:
+		return readLiteralItems(e, env)
+	case Vector:
+		items, err := readLiteralItems(e.Items(), env)
+		if err != nil {
+			return nil, err
+		}
+		return NewVector(items...), nil
+	case Set:
+		var items []Expression
+		e.Each(func(item Expression) bool {
+			items = append(items, item)
+			return true
+		})
+		items, err := readLiteralItems(items, env)
+		if err != nil {
+			return nil, err
+		}
+		return NewSet(items...), nil
+	case Map:
+		t := Map{}.Transient()
+		var err error
+		e.Each(func(k, v Expression) bool {
+			if k, err = readLiterals(k, env); err != nil {
+				return false
+			}
+			if v, err = readLiterals(v, env); err != nil {
+				return false
+			}
+			t.Assoc(k, v)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return t.Persistent(), nil
+	}
+	return data, nil
+}
+
+func readLiteralItems(items []Expression, env *Environment) (List, error) {
+	result := make(List, len(items))
+	for i, item := range items {
+		var err error
+		if result[i], err = readLiterals(item, env); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// symbols -------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("symbols", "symbol", builtinSymbol)
+	defineBuiltin("symbols", "symbol?", builtinIsSymbol)
+	defineBuiltin("symbols", "symbol->string", builtinSymbolToString)
+	defineBuiltin("symbols", "string->symbol", builtinStringToSymbol)
+	defineBuiltin("symbols", "namespace", builtinNamespace)
+	defineBuiltin("symbols", "name", builtinName)
+	defineBuiltin("symbols", "gensym", builtinGensym)
+}
+
+// builtinSymbol builds a symbol from a name, or from a namespace and a name.
+func builtinSymbol(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("symbol requires 1 or 2 arguments")
+	}
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case String:
+			parts[i] = string(v)
+		case Name:
+			parts[i] = v.String()
+		default:
+			return nil, fmt.Errorf("symbol expects strings, got %T", arg)
+		}
+		if parts[i] == "" {
+			return nil, fmt.Errorf("symbol requires non-empty names")
+		}
+	}
+	name := strings.Join(parts, "/")
+	if err := env.checkIntern(name, false); err != nil {
+		return nil, err
+	}
+	return Intern(name), nil
+}
+
+func builtinIsSymbol(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("symbol? requires exactly one argument")
+	}
+	_, ok := args[0].(Name)
+	return Boolean(ok), nil
+}
+
+func builtinSymbolToString(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("symbol->string requires exactly one argument")
+	}
+	name, ok := args[0].(Name)
+	if !ok {
+		return nil, fmt.Errorf("symbol->string expects a symbol, got %T", args[0])
+	}
+	return String(name.String()), nil
+}
+
+func builtinStringToSymbol(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("string->symbol requires exactly one argument")
+	}
+	str, ok := args[0].(String)
+	if !ok {
+		return nil, fmt.Errorf("string->symbol expects a string, got %T", args[0])
+	}
+	if str == "" {
+		return nil, fmt.Errorf("string->symbol requires a non-empty string")
+	}
+	if err := env.checkIntern(string(str), false); err != nil {
+		return nil, err
+	}
+	return Intern(string(str)), nil
+}
+
+func builtinNamespace(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("namespace requires exactly one argument")
+	}
+	name, ok := args[0].(Name)
+	if !ok {
+		return nil, fmt.Errorf("namespace expects a symbol, got %T", args[0])
+	}
+	if ns := name.Namespace(); ns != "" {
+		return String(ns), nil
+	}
+	return nil, nil
+}
+
+func builtinName(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("name requires exactly one argument")
+	}
+	switch v := args[0].(type) {
+	case Name:
+		return String(v.Local()), nil
+	case *Keyword:
+		return String(v.name), nil
+	case String:
+		return v, nil
+	}
+	return nil, fmt.Errorf("name expects a symbol, keyword or string, got %T", args[0])
+}
+
+func builtinGensym(args []Expression, env *Environment) (Expression, error) {
+	prefix := "G"
+	if len(args) == 1 {
+		p, ok := args[0].(String)
+		if !ok {
+			return nil, fmt.Errorf("gensym expects a string prefix, got %T", args[0])
+		}
+		prefix = string(p)
+	} else if len(args) > 1 {
+		return nil, fmt.Errorf("gensym takes at most one argument")
+	}
+	if err := env.countInterned(len(prefix)); err != nil {
+		return nil, err
+	}
+	return Gensym(prefix), nil
+}
+
+// keywords ------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("keywords", "keyword", builtinKeyword)
+	defineBuiltin("keywords", "keyword?", builtinIsKeyword)
+}
+
+func builtinKeyword(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("keyword requires exactly one argument")
+	}
+	switch v := args[0].(type) {
+	case *Keyword:
+		return v, nil
+	case String:
+		if v == "" {
+			return nil, fmt.Errorf("keyword requires a non-empty string")
+		}
+		if err := env.checkIntern(string(v), true); err != nil {
+			return nil, err
+		}
+		return InternKeyword(string(v)), nil
+	case Name:
+		if err := env.checkIntern(v.String(), true); err != nil {
+			return nil, err
+		}
+		return InternKeyword(v.String()), nil
+	}
+	return nil, fmt.Errorf("keyword expects a string or symbol, got %T", args[0])
+}
+
+func builtinIsKeyword(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("keyword? requires exactly one argument")
+	}
+	_, ok := args[0].(*Keyword)
+	return Boolean(ok), nil
+}
+
+// maps ----------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("maps", "hash-map", builtinHashMap)
+	defineBuiltin("maps", "get", builtinGet)
+	defineBuiltin("maps", "assoc", builtinAssoc)
+	defineBuiltin("maps", "dissoc", builtinDissoc)
+	defineBuiltin("maps", "keys", builtinKeys)
+	defineBuiltin("maps", "vals", builtinVals)
+	defineBuiltin("maps", "merge", builtinMerge)
+	defineBuiltin("maps", "update", builtinUpdate)
+	defineBuiltin("maps", "contains?", builtinContains)
+	defineBuiltin("maps", "get-in", builtinGetIn)
+	defineBuiltin("maps", "assoc-in", builtinAssocIn)
+	defineBuiltin("maps", "transient", builtinTransient)
+	defineBuiltin("maps", "assoc!", builtinAssocBang)
+	defineBuiltin("maps", "dissoc!", builtinDissocBang)
+	defineBuiltin("maps", "persistent!", builtinPersistentBang)
+}
+
+// toMap accepts nil as the empty map so (assoc nil k v) builds a new one.
+func toMap(name string, value Expression) (Map, error) {
+	switch m := value.(type) {
+	case nil:
+		return Map{}, nil
+	case Map:
+		return m, nil
+	}
+	return Map{}, fmt.Errorf("%s expects a map, got %T", name, value)
+}
+
+func builtinHashMap(args []Expression, env *Environment) (Expression, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("hash-map requires an even number of arguments")
+	}
+	t := Map{}.Transient()
+	for i := 0; i < len(args); i += 2 {
+		t.Assoc(args[i], args[i+1])
+	}
+	return t.Persistent(), nil
+}
+
+func builtinGet(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("get requires 2 or 3 arguments")
+	}
+	if value, ok := lookup(args[0], args[1]); ok {
+		return value, nil
+	}
+	if len(args) == 3 {
+		return args[2], nil
+	}
+	return nil, nil
+}
+
+// lookup finds key in a map, a set, or (by index) a vector.
+func lookup(coll, key Expression) (Expression, bool) {
+	switch c := coll.(type) {
+	case Map:
+		return c.Get(key)
+	case Set:
+		if c.Contains(key) {
+			return key, true
+		}
+	case Vector:
+		if i, ok := toIndex(key); ok && i < c.Count() {
+			return c.Nth(i), true
+		}
+	case *Record:
+		return c.Get(key)
+	}
+	return nil, false
+}
+
+func toIndex(value Expression) (int, bool) {
+	n, ok := value.(Number)
+	if !ok || n < 0 || n != Number(int(n)) {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func builtinAssoc(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, fmt.Errorf("assoc requires a collection followed by key/value pairs")
+	}
+	result := args[0]
+	for i := 1; i < len(args); i += 2 {
+		var err error
+		if result, err = assoc(result, args[i], args[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func assoc(coll, key, value Expression) (Expression, error) {
+	if r, ok := coll.(*Record); ok {
+		return r.With(key, value)
+	}
+	if v, ok := coll.(Vector); ok {
+		i, ok := toIndex(key)
+		if !ok {
+			return nil, fmt.Errorf("assoc expects a vector index, got %v", key)
+		}
+		return v.AssocN(i, value)
+	}
+	m, err := toMap("assoc", coll)
+	if err != nil {
+		return nil, err
+	}
+	return m.Assoc(key, value), nil
+}
+
+func builtinDissoc(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("dissoc requires at least one argument")
+	}
+	m, err := toMap("dissoc", args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range args[1:] {
+		m = m.Dissoc(key)
+	}
+	return m, nil
+}
+
+func builtinKeys(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("keys requires exactly one argument")
+	}
+	m, err := toMap("keys", args[0])
+	if err != nil {
+		return nil, err
+	}
+	result := make(List, 0, m.Count())
+	m.Each(func(k, v Expression) bool {
+		result = append(result, k)
+		return true
+	})
+	return result, nil
+}
+
+func builtinVals(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("vals requires exactly one argument")
+	}
+	m, err := toMap("vals", args[0])
+	if err != nil {
+		return nil, err
+	}
+	result := make(List, 0, m.Count())
+	m.Each(func(k, v Expression) bool {
+		result = append(result, v)
+		return true
+	})
+	return result, nil
+}
+
+func builtinMerge(args []Expression, env *Environment) (Expression, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	first, err := toMap("merge", args[0])
+	if err != nil {
+		return nil, err
+	}
+	t := first.Transient()
+	for _, arg := range args[1:] {
+		m, err := toMap("merge", arg)
+		if err != nil {
+			return nil, err
+		}
+		m.Each(func(k, v Expression) bool {
+			t.Assoc(k, v)
+			return true
+		})
+	}
+	return t.Persistent(), nil
+}
+
+func builtinUpdate(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("update requires at least 3 arguments")
+	}
+	old, _ := lookup(args[0], args[1])
+	value, err := apply(args[2], append([]Expression{old}, args[3:]...), env)
+	if err != nil {
+		return nil, err
+	}
+	return assoc(args[0], args[1], value)
+}
+
+func builtinContains(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("contains? requires exactly two arguments")
+	}
+	_, ok := lookup(args[0], args[1])
+	return Boolean(ok), nil
+}
+
+func builtinGetIn(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("get-in requires 2 or 3 arguments")
+	}
+	path, ok := toSlice(args[1])
+	if !ok {
+		return nil, fmt.Errorf("get-in expects a sequence of keys, got %T", args[1])
+	}
+	current := args[0]
+	for _, key := range path {
+		if current, ok = lookup(current, key); !ok {
+			break
+		}
+	}
+	if !ok && len(args) == 3 {
+		return args[2], nil
+	}
+	return current, nil
+}
+
+func builtinAssocIn(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("assoc-in requires exactly three arguments")
+	}
+	path, ok := toSlice(args[1])
+	if !ok || len(path) == 0 {
+		return nil, fmt.Errorf("assoc-in expects a non-empty sequence of keys")
+	}
+	return assocIn(args[0], path, args[2])
+}
+
+func assocIn(current Expression, path []Expression, value Expression) (Expression, error) {
+	if len(path) == 1 {
+		return assoc(current, path[0], value)
+	}
+	child, _ := lookup(current, path[0])
+	updated, err := assocIn(child, path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	return assoc(current, path[0], updated)
+}
+
+func builtinTransient(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("transient requires exactly one argument")
+	}
+	m, err := toMap("transient", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.Transient(), nil
+}
+
+func toTransient(name string, value Expression) (*TransientMap, error) {
+	t, ok := value.(*TransientMap)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a transient map, got %T", name, value)
+	}
+	return t, nil
+}
+
+func builtinAssocBang(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, fmt.Errorf("assoc! requires a transient map followed by key/value pairs")
+	}
+	t, err := toTransient("assoc!", args[0])
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i += 2 {
+		if err := t.Assoc(args[i], args[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func builtinDissocBang(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("dissoc! requires at least one argument")
+	}
+	t, err := toTransient("dissoc!", args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range args[1:] {
+		if err := t.Dissoc(key); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func builtinPersistentBang(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("persistent! requires exactly one argument")
+	}
+	t, err := toTransient("persistent!", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if t.edit == nil {
+		return nil, fmt.Errorf("transient used after persistent!")
+	}
+	return t.Persistent(), nil
+}
+
+// collections ---------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("collections", "vector", builtinVector)
+	defineBuiltin("collections", "hash-set", builtinHashSet)
+	defineBuiltin("collections", "nth", builtinNth)
+	defineBuiltin("collections", "conj", builtinConj)
+	defineBuiltin("collections", "disj", builtinDisj)
+	defineBuiltin("collections", "count", builtinCount)
+	defineBuiltin("collections", "union", builtinUnion)
+	defineBuiltin("collections", "intersection", builtinIntersection)
+	defineBuiltin("collections", "difference", builtinDifference)
+	defineBuiltin("collections", "subset?", builtinSubset)
+}
+
+// toSlice returns the elements of a list or vector.
+func toSlice(value Expression) ([]Expression, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case List:
+		return v, true
+	case Vector:
+		return v.Items(), true
+	}
+	return nil, false
+}
+
+func toSet(name string, value Expression) (Set, error) {
+	switch s := value.(type) {
+	case nil:
+		return Set{}, nil
+	case Set:
+		return s, nil
+	}
+	return Set{}, fmt.Errorf("%s expects a set, got %T", name, value)
+}
+
+func builtinVector(args []Expression, env *Environment) (Expression, error) {
+	return NewVector(args...), nil
+}
+
+func builtinHashSet(args []Expression, env *Environment) (Expression, error) {
+	return NewSet(args...), nil
+}
+
+func builtinNth(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("nth requires 2 or 3 arguments")
+	}
+	i, ok := toIndex(args[1])
+	if !ok {
+		return nil, fmt.Errorf("nth expects a non-negative integer index, got %v", args[1])
+	}
+	var value Expression
+	found := false
+	switch coll := args[0].(type) {
+	case Vector:
+		if found = i < coll.Count(); found {
+			value = coll.Nth(i)
+		}
+	case List:
+		if found = i < len(coll); found {
+			value = coll[i]
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("nth expects a list or vector, got %T", args[0])
+	}
+	if found {
+		return value, nil
+	}
+	if len(args) == 3 {
+		return args[2], nil
+	}
+	return nil, fmt.Errorf("nth index %d out of bounds", i)
+}
+
+func builtinConj(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("conj requires at least one argument")
+	}
+	switch coll := args[0].(type) {
+	case Vector:
+		for _, item := range args[1:] {
+			coll = coll.Conj(item)
+		}
+		return coll, nil
+	case Set:
+		for _, item := range args[1:] {
+			coll = coll.Conj(item)
+		}
+		return coll, nil
+	case Map:
+		for _, item := range args[1:] {
+			pair, ok := item.(Vector)
+			if !ok || pair.Count() != 2 {
+				return nil, fmt.Errorf("conj on a map expects [key value] pairs")
+			}
+			coll = coll.Assoc(pair.Nth(0), pair.Nth(1))
+		}
+		return coll, nil
+	case List, nil:
+		// Lists grow at the front.
+		list, _ := coll.(List)
+		result := make(List, 0, len(list)+len(args)-1)
+		for i := len(args) - 1; i >= 1; i-- {
+			result = append(result, args[i])
+		}
+		return append(result, list...), nil
+	}
+	return nil, fmt.Errorf("conj expects a collection, got %T", args[0])
+}
+
+func builtinDisj(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("disj requires at least one argument")
+	}
+	s, err := toSet("disj", args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range args[1:] {
+		s = s.Disj(item)
+	}
+	return s, nil
+}
+
+func builtinCount(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("count requires exactly one argument")
+	}
+	switch coll := args[0].(type) {
+	case nil:
+		return Number(0), nil
+	case List:
+		return Number(len(coll)), nil
+	case Vector:
+		return Number(coll.Count()), nil
+	case Set:
+		return Number(coll.Count()), nil
+	case Map:
+		return Number(coll.Count()), nil
+	}
+	return nil, fmt.Errorf("count expects a collection, got %T", args[0])
+}
+
+func builtinUnion(args []Expression, env *Environment) (Expression, error) {
+	result := Set{}
+	for _, arg := range args {
+		s, err := toSet("union", arg)
+		if err != nil {
+			return nil, err
+		}
+		s.Each(func(item Expression) bool {
+			result = result.Conj(item)
+			return true
+		})
+	}
+	return result, nil
+}
+
+func builtinIntersection(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("intersection requires at least one argument")
+	}
+	result, err := toSet("intersection", args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args[1:] {
+		s, err := toSet("intersection", arg)
+		if err != nil {
+			return nil, err
+		}
+		result.Each(func(item Expression) bool {
+			if !s.Contains(item) {
+				result = result.Disj(item)
+			}
+			return true
+		})
+	}
+	return result, nil
+}
+
+func builtinDifference(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("difference requires at least one argument")
+	}
+	result, err := toSet("difference", args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args[1:] {
+		s, err := toSet("difference", arg)
+		if err != nil {
+			return nil, err
+		}
+		s.Each(func(item Expression) bool {
+			result = result.Disj(item)
+			return true
+		})
+	}
+	return result, nil
+}
+
+func builtinSubset(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("subset? requires exactly two arguments")
+	}
+	a, err := toSet("subset?", args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := toSet("subset?", args[1])
+	if err != nil {
+		return nil, err
+	}
+	subset := a.Count() <= b.Count()
+	a.Each(func(item Expression) bool {
+		subset = subset && b.Contains(item)
+		return subset
+	})
+	return Boolean(subset), nil
+}
+
+// dispatch ------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("dispatch", "type", builtinType)
+	defineBuiltin("dispatch", "satisfies?", builtinSatisfies)
+	defineBuiltin("dispatch", "derive", builtinDerive)
+	defineBuiltin("dispatch", "isa?", builtinIsa)
+	defineBuiltin("dispatch", "variants-of", builtinVariantsOf)
+}
+
+func builtinType(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("type requires exactly one argument")
+	}
+	return Intern(typeName(args[0])), nil
+}
+
+func builtinSatisfies(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("satisfies? requires exactly two arguments")
+	}
+	protocol, ok := args[0].(*Protocol)
+	if !ok {
+		return nil, fmt.Errorf("satisfies? expects a protocol, got %v", args[0])
+	}
+	return Boolean(protocol.satisfiedBy(typeKey(args[1]))), nil
+}
+
+func builtinDerive(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("derive requires exactly two arguments")
+	}
+	return nil, env.state.derive(args[0], args[1])
+}
+
+func builtinIsa(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("isa? requires exactly two arguments")
+	}
+	return Boolean(env.state.isa(args[0], args[1])), nil
+}
+
+func builtinVariantsOf(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("variants-of requires exactly one argument")
+	}
+	typ, ok := args[0].(*SumType)
+	if !ok {
+		return nil, fmt.Errorf("variants-of expects a type declared with deftype, got %v", args[0])
+	}
+	result := make(List, len(typ.variants))
+	for i, v := range typ.variants {
+		result[i] = v.declaration()
+	}
+	return result, nil
+}
+
+// strings -------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("strings", "str", builtinStr)
+	defineBuiltin("strings", "substring", builtinSubstring)
+	defineBuiltin("strings", "string-length", builtinStringLength)
+	defineBuiltin("strings", "split", builtinSplit)
+	defineBuiltin("strings", "join", builtinJoin)
+	defineBuiltin("strings", "trim", builtinTrim)
+	defineBuiltin("strings", "upper", builtinUpper)
+	defineBuiltin("strings", "lower", builtinLower)
+	defineBuiltin("strings", "starts-with?", builtinStartsWith)
+	defineBuiltin("strings", "ends-with?", builtinEndsWith)
+	defineBuiltin("strings", "index-of", builtinIndexOf)
+	defineBuiltin("strings", "replace", builtinReplace)
+	defineBuiltin("strings", "string->list", builtinStringToList)
+	defineBuiltin("strings", "string->number", builtinStringToNumber)
+	defineBuiltin("strings", "number->string", builtinNumberToString)
+	defineBuiltin("strings", "char->integer", builtinCharToInteger)
+	defineBuiltin("strings", "integer->char", builtinIntegerToChar)
+}
+
+// displayString renders a value the way str concatenates it: in display
+// form, with nil as the empty string.
+func displayString(value Expression) string {
+	if value == nil {
+		return ""
+	}
+	return Display(value)
+}
+
+func toString(name string, value Expression) (string, error) {
+	s, ok := value.(String)
+	if !ok {
+		return "", fmt.Errorf("%s expects a string, got %T", name, value)
+	}
+	return string(s), nil
+}
+
+// stringArgs checks the argument count and that every argument is a string.
+func stringArgs(name string, args []Expression, count int) ([]string, error) {
+	if len(args) != count {
+		return nil, fmt.Errorf("%s requires exactly %d arguments", name, count)
+	}
+	result := make([]string, count)
+	for i, arg := range args {
+		var err error
+		if result[i], err = toString(name, arg); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func builtinStr(args []Expression, env *Environment) (Expression, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		if err := env.appendString(&sb, displayString(arg)); err != nil {
+			return nil, err
+		}
+	}
+	return String(sb.String()), nil
+}
+
+func builtinSubstring(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("substring requires 2 or 3 arguments")
+	}
+	s, err := toString("substring", args[0])
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	start, ok := toIndex(args[1])
+	end := len(runes)
+	if len(args) == 3 {
+		var endOk bool
+		end, endOk = toIndex(args[2])
+		ok = ok && endOk
+	}
+	if !ok || start > end || end > len(runes) {
+		return nil, fmt.Errorf("substring indices out of range for string of length %d", len(runes))
+	}
+	return String(runes[start:end]), nil
+}
+
+func builtinStringLength(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("string-length", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return Number(utf8.RuneCountInString(strs[0])), nil
+}
+
+// builtinSplit splits a string at each occurrence of a separator, or into
+// characters if the separator is empty.
+func builtinSplit(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("split", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strs[0], strs[1])
+	result := make(List, len(parts))
+	for i, part := range parts {
+		result[i] = String(part)
+	}
+	return result, nil
+}
+
+// builtinJoin handles (join coll) and (join separator coll).
+func builtinJoin(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("join requires 1 or 2 arguments")
+	}
+	separator := ""
+	if len(args) == 2 {
+		var err error
+		if separator, err = toString("join", args[0]); err != nil {
+			return nil, err
+		}
+	}
+	items, ok := toSlice(args[len(args)-1])
+	if !ok {
+		return nil, fmt.Errorf("join expects a list or vector, got %T", args[len(args)-1])
+	}
+	var sb strings.Builder
+	for i, item := range items {
+		if i > 0 {
+			if err := env.appendString(&sb, separator); err != nil {
+				return nil, err
+			}
+		}
+		if err := env.appendString(&sb, displayString(item)); err != nil {
+			return nil, err
+		}
+	}
+	return String(sb.String()), nil
+}
+
+func builtinTrim(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("trim", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return String(strings.TrimSpace(strs[0])), nil
+}
+
+func builtinUpper(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("upper", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return String(strings.ToUpper(strs[0])), nil
+}
+
+func builtinLower(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("lower", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return String(strings.ToLower(strs[0])), nil
+}
+
+func builtinStartsWith(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("starts-with?", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return Boolean(strings.HasPrefix(strs[0], strs[1])), nil
+}
+
+func builtinEndsWith(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("ends-with?", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return Boolean(strings.HasSuffix(strs[0], strs[1])), nil
+}
+
+// builtinIndexOf returns the rune index of the first occurrence, or nil.
+func builtinIndexOf(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("index-of", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	i := strings.Index(strs[0], strs[1])
+	if i < 0 {
+		return nil, nil
+	}
+	return Number(utf8.RuneCountInString(strs[0][:i])), nil
+}
+
+func builtinReplace(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("replace", args, 3)
+	if err != nil {
+		return nil, err
+	}
+	if len(strs[2]) > len(strs[1]) {
+		matches := strings.Count(strs[0], strs[1])
+		if err := env.checkSize(len(strs[0]) + matches*(len(strs[2])-len(strs[1]))); err != nil {
+			return nil, err
+		}
+	}
+	return String(strings.ReplaceAll(strs[0], strs[1], strs[2])), nil
+}
+
+func builtinStringToList(args []Expression, env *Environment) (Expression, error) {
+	strs, err := stringArgs("string->list", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	result := make(List, 0, len(strs[0]))
+	for _, r := range strs[0] {
+		result = append(result, Char(r))
+	}
+	return result, nil
+}
+
+func toRadix(name string, args []Expression) (int, error) {
+	if len(args) < 2 {
+		return 10, nil
+	}
+	radix, ok := toIndex(args[1])
+	if !ok || radix < 2 || radix > 36 {
+		return 0, fmt.Errorf("%s radix must be an integer between 2 and 36", name)
+	}
+	return radix, nil
+}
+
+// builtinStringToNumber returns nil when the string is not a number.
+func builtinStringToNumber(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("string->number requires 1 or 2 arguments")
+	}
+	s, err := toString("string->number", args[0])
+	if err != nil {
+		return nil, err
+	}
+	radix, err := toRadix("string->number", args)
+	if err != nil {
+		return nil, err
+	}
+	s = strings.TrimSpace(s)
+	if radix == 10 {
+		// The same syntax as read, so ##Inf is a number but inf is not.
+		if num, ok := parseNumber(s); ok {
+			return num, nil
+		}
+		return nil, nil
+	}
+	if i, err := strconv.ParseInt(s, radix, 64); err == nil {
+		return Number(i), nil
+	}
+	return nil, nil
+}
+
+func builtinNumberToString(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("number->string requires 1 or 2 arguments")
+	}
+	n, ok := args[0].(Number)
+	if !ok {
+		return nil, fmt.Errorf("number->string expects a number, got %T", args[0])
+	}
+	radix, err := toRadix("number->string", args)
+	if err != nil {
+		return nil, err
+	}
+	if radix == 10 {
+		return String(formatNumber(float64(n))), nil
+	}
+	if n != Number(int64(n)) {
+		return nil, fmt.Errorf("number->string with a radix expects an integer, got %v", n)
+	}
+	return String(strconv.FormatInt(int64(n), radix)), nil
+}
+
+func builtinCharToInteger(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("char->integer requires exactly one argument")
+	}
+	c, ok := args[0].(Char)
+	if !ok {
+		return nil, fmt.Errorf("char->integer expects a character, got %T", args[0])
+	}
+	return Number(c), nil
+}
+
+func builtinIntegerToChar(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("integer->char requires exactly one argument")
+	}
+	code, ok := toIndex(args[0])
+	if !ok || code < 0 || code > unicode.MaxRune || !utf8.ValidRune(rune(code)) {
+		return nil, fmt.Errorf("integer->char expects a valid code point, got %v", args[0])
+	}
+	return Char(code), nil
+}
+
+// formatting ----------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("formatting", "format", builtinFormat)
+}
+
+// formatSpec says how to render one value: the verb (a display, s write,
+// d integer, f fixed, e exponent, x/o/b integer in base 16/8/2), minimum
+// width, precision, padding character and alignment. width and precision
+// are -1 when unset.
+type formatSpec struct {
+	verb      rune
+	width     int
+	precision int
+	pad       rune
+	left      bool
+	center    bool
+}
+
+// maxFormatWidth bounds the width and precision of a format spec, so that
+// a typo or hostile template cannot ask for gigabytes of padding.
+const maxFormatWidth = 10000
+
+func defaultSpec(verb rune) formatSpec {
+	return formatSpec{verb: verb, width: -1, precision: -1, pad: ' ', left: verb == 'a' || verb == 's'}
+}
+
+func (spec formatSpec) render(value Expression, env *Environment) (string, error) {
+	if spec.width > maxFormatWidth || spec.precision > maxFormatWidth {
+		return "", fmt.Errorf("format width or precision exceeds %d", maxFormatWidth)
+	}
+	if err := env.checkSize(spec.width); err != nil {
+		return "", err
+	}
+	if err := env.checkSize(spec.precision); err != nil {
+		return "", err
+	}
+	var s string
+	switch spec.verb {
+	case 'a':
+		s = displayString(value)
+	case 's':
+		s = Write(value)
+	case 'd', 'x', 'o', 'b', 'f', 'e':
+		n, ok := value.(Number)
+		if !ok {
+			return "", fmt.Errorf("format directive ~%c expects a number, got %v", spec.verb, value)
+		}
+		s = spec.renderNumber(float64(n))
+	default:
+		return "", fmt.Errorf("unknown format directive ~%c", spec.verb)
+	}
+	return spec.padded(s), nil
+}
+
+func (spec formatSpec) renderNumber(f float64) string {
+	bases := map[rune]int{'d': 10, 'x': 16, 'o': 8, 'b': 2}
+	switch base, integer := bases[spec.verb]; {
+	case integer && f == math.Trunc(f) && math.Abs(f) < 1<<63:
+		return strconv.FormatInt(int64(f), base)
+	case integer:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	case spec.verb == 'e':
+		return strconv.FormatFloat(f, 'e', spec.precision, 64)
+	}
+	return strconv.FormatFloat(f, 'f', spec.precision, 64)
+}
+
+// padded pads s to the minimum width. Zero padding goes after the sign.
+func (spec formatSpec) padded(s string) string {
+	n := spec.width - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return s
+	}
+	fill := strings.Repeat(string(spec.pad), n)
+	switch {
+	case spec.center:
+		// Any odd unit of padding goes on the right.
+		return fill[:n/2*utf8.RuneLen(spec.pad)] + s + fill[n/2*utf8.RuneLen(spec.pad):]
+	case spec.left:
+		return s + fill
+	case spec.pad == '0' && strings.HasPrefix(s, "-"):
+		return "-" + fill + s[1:]
+	}
+	return fill + s
+}
+
+// formatDirectives renders a control string with ~ directives in the style
+// of Common Lisp's format: ~a ~s ~d ~f ~e ~x ~o ~b consume an argument,
+// ~% is a newline and ~~ a tilde. Comma-separated prefix parameters give
+// the width, then the precision for ~f and ~e, and 'c sets the padding
+// character, as in ~8,2f or ~5,'0d.
+func formatDirectives(control string, args []Expression, env *Environment) (string, error) {
+	var sb strings.Builder
+	runes := []rune(control)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '~' {
+			sb.WriteRune(runes[i])
+			continue
+		}
+		var params []int
+		pad := ' '
+		j := i + 1
+	params:
+		for j < len(runes) {
+			switch {
+			case runes[j] == '\'' && j+1 < len(runes):
+				pad = runes[j+1]
+				j += 2
+			case unicode.IsDigit(runes[j]):
+				start := j
+				for j < len(runes) && unicode.IsDigit(runes[j]) {
+					j++
+				}
+				n, _ := strconv.Atoi(string(runes[start:j]))
+				params = append(params, n)
+			case runes[j] == ',':
+				if j == i+1 || runes[j-1] == ',' {
+					params = append(params, -1)
+				}
+				j++
+			default:
+				break params
+			}
+		}
+		if j >= len(runes) {
+			return "", fmt.Errorf("format string ends in the middle of a directive")
+		}
+		verb := unicode.ToLower(runes[j])
+		i = j
+		switch verb {
+		case '%':
+			sb.WriteString("\n")
+			continue
+		case '~':
+			sb.WriteRune('~')
+			continue
+		}
+		if len(args) == 0 {
+			return "", fmt.Errorf("format: not enough arguments for ~%c", verb)
+		}
+		spec := defaultSpec(verb)
+		spec.pad = pad
+		if len(params) > 0 {
+			spec.width = params[0]
+		}
+		if len(params) > 1 {
+			spec.precision = params[1]
+		}
+		s, err := spec.render(args[0], env)
+		if err != nil {
+			return "", err
+		}
+		if err := env.appendString(&sb, s); err != nil {
+			return "", err
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		return "", fmt.Errorf("format: %d unused arguments", len(args))
+	}
+	return sb.String(), nil
+}
+
+// parseFormatSpec reads an interpolation spec such as >10, *^9, 08.2f or x:
+// an optional fill character and alignment (< left, > right, ^ centre),
+// a 0 flag for zero padding, a width, a precision and a
+// verb.
+func parseFormatSpec(text string) (formatSpec, bool) {
+	runes := []rune(text)
+	spec := defaultSpec('a')
+	explicitAlign := false
+	i := 0
+	if len(runes) >= 2 && strings.ContainsRune("<>^", runes[1]) {
+		spec.pad, spec.left, spec.center, explicitAlign = runes[0], runes[1] == '<', runes[1] == '^', true
+		i = 2
+	} else if len(runes) >= 1 && strings.ContainsRune("<>^", runes[0]) {
+		spec.left, spec.center, explicitAlign = runes[0] == '<', runes[0] == '^', true
+		i = 1
+	}
+	if i < len(runes) && runes[i] == '0' {
+		spec.pad = '0'
+		i++
+	}
+	readInt := func() int {
+		start := i
+		for i < len(runes) && unicode.IsDigit(runes[i]) {
+			i++
+		}
+		if start == i {
+			return -1
+		}
+		n, _ := strconv.Atoi(string(runes[start:i]))
+		return n
+	}
+	spec.width = readInt()
+	if i < len(runes) && runes[i] == '.' {
+		i++
+		if spec.precision = readInt(); spec.precision < 0 {
+			return spec, false
+		}
+		spec.verb = 'f'
+	}
+	if i < len(runes) {
+		if !strings.ContainsRune("asdfexob", runes[i]) {
+			return spec, false
+		}
+		spec.verb = runes[i]
+		i++
+	}
+	if !explicitAlign {
+		spec.left = spec.verb == 'a' || spec.verb == 's'
+	}
+	return spec, i == len(runes)
+}
+
+// interpolate renders a fmt template, evaluating each {expr} or
+// {expr:spec} in env. {{ and }} stand for literal braces.
+func interpolate(template string, env *Environment) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c == '}' {
+			if !strings.HasPrefix(template[i:], "}}") {
+				return "", fmt.Errorf("fmt: unmatched } in template")
+			}
+			sb.WriteByte('}')
+			i++
+			continue
+		}
+		if c != '{' {
+			sb.WriteByte(c)
+			continue
+		}
+		if strings.HasPrefix(template[i:], "{{") {
+			sb.WriteByte('{')
+			i++
+			continue
+		}
+		end, depth := i+1, 1
+		for ; end < len(template) && depth > 0; end++ {
+			switch template[end] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+		}
+		if depth > 0 {
+			return "", fmt.Errorf("fmt: unterminated { in template")
+		}
+		source := template[i+1 : end-1]
+		spec := defaultSpec('a')
+		if colon := strings.LastIndex(source, ":"); colon > 0 {
+			if parsed, ok := parseFormatSpec(source[colon+1:]); ok {
+				source, spec = source[:colon], parsed
+			}
+		}
+		expr, err := Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("fmt: %v", err)
+		}
+		value, err := evaluate(expr, env)
+		if err != nil {
+			return "", err
+		}
+		s, err := spec.render(value, env)
+		if err != nil {
+			return "", err
+		}
+		if err := env.appendString(&sb, s); err != nil {
+			return "", err
+		}
+		i = end - 1
+	}
+	return sb.String(), nil
+}
+
+func builtinFormat(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("format requires a control string")
+	}
+	control, err := toString("format", args[0])
+	if err != nil {
+		return nil, err
+	}
+	s, err := formatDirectives(control, args[1:], env)
+	if err != nil {
+		return nil, err
+	}
+	return String(s), nil
+}
+
+// evalFmt handles (fmt "template"). It is a special form because the
+// embedded expressions are evaluated in the caller's environment.
+func evalFmt(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("fmt requires exactly one argument")
+	}
+	template, ok := args[0].(String)
+	if !ok {
+		return nil, fmt.Errorf("fmt expects a string literal, got %v", args[0])
+	}
+	s, err := interpolate(string(template), env)
+	if err != nil {
+		return nil, err
+	}
+	return String(s), nil
+}
+
+// regex ---------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("regex", "re-pattern", builtinRePattern)
+	defineBuiltin("regex", "re-match", builtinReMatch)
+	defineBuiltin("regex", "re-find-all", builtinReFindAll)
+	defineBuiltin("regex", "re-replace", builtinReReplace)
+	defineBuiltin("regex", "re-split", builtinReSplit)
+}
+
+// regexArgs accepts a Regex or a pattern string followed by a subject
+// string.
+func regexArgs(name string, args []Expression) (*Regex, string, error) {
+	var re *Regex
+	switch pattern := args[0].(type) {
+	case *Regex:
+		re = pattern
+	case String:
+		var err error
+		if re, err = CompileRegex(string(pattern)); err != nil {
+			return nil, "", fmt.Errorf("%s: %v", name, err)
+		}
+	default:
+		return nil, "", fmt.Errorf("%s expects a regex, got %T", name, args[0])
+	}
+	s, err := toString(name, args[1])
+	return re, s, err
+}
+
+func builtinRePattern(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("re-pattern requires exactly one argument")
+	}
+	pattern, err := toString("re-pattern", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return CompileRegex(pattern)
+}
+
+// builtinReMatch returns the first match in the string, or nil.
+func builtinReMatch(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("re-match requires exactly two arguments")
+	}
+	re, s, err := regexArgs("re-match", args)
+	if err != nil {
+		return nil, err
+	}
+	loc := re.re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	return re.matchResult(s, loc), nil
+}
+
+func builtinReFindAll(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("re-find-all requires exactly two arguments")
+	}
+	re, s, err := regexArgs("re-find-all", args)
+	if err != nil {
+		return nil, err
+	}
+	result := List{}
+	for _, loc := range re.re.FindAllStringSubmatchIndex(s, -1) {
+		result = append(result, re.matchResult(s, loc))
+	}
+	return result, nil
+}
+
+// builtinReReplace replaces every match. A string replacement may refer to
+// groups as $1 or ${name}; a function replacement is called with each
+// match, shaped as by re-match, and its result is displayed.
+func builtinReReplace(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("re-replace requires exactly three arguments")
+	}
+	re, s, err := regexArgs("re-replace", args)
+	if err != nil {
+		return nil, err
+	}
+	if replacement, ok := args[2].(String); ok {
+		return String(re.re.ReplaceAllString(s, string(replacement))), nil
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, loc := range re.re.FindAllStringSubmatchIndex(s, -1) {
+		value, err := apply(args[2], []Expression{re.matchResult(s, loc)}, env)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(s[last:loc[0]])
+		sb.WriteString(displayString(value))
+		last = loc[1]
+	}
+	sb.WriteString(s[last:])
+	return String(sb.String()), nil
+}
+
+func builtinReSplit(args []Expression, env *Environment) (Expression, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("re-split requires 2 or 3 arguments")
+	}
+	re, s, err := regexArgs("re-split", args)
+	if err != nil {
+		return nil, err
+	}
+	// A limit of 0 or less splits at every match.
+	limit := -1
+	if len(args) == 3 {
+		n, ok := args[2].(Number)
+		if !ok || n != Number(int(n)) {
+			return nil, fmt.Errorf("re-split limit must be an integer")
+		}
+		if n > 0 {
+			limit = int(n)
+		}
+	}
+	parts := re.re.Split(s, limit)
+	result := make(List, len(parts))
+	for i, part := range parts {
+		result[i] = String(part)
+	}
+	return result, nil
+}
+
+// eval ----------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("eval", "eval", builtinEval)
+}
+
+// builtinEval evaluates a form, such as a quoted list or the result of
+// read-string.
+func builtinEval(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("eval requires exactly one argument")
+	}
+	return evaluate(args[0], env)
+}
+
+// errors --------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("errors", "throw", builtinThrow)
+	defineBuiltin("errors", "error?", builtinIsError)
+	defineBuiltin("errors", "error-message", builtinErrorMessage)
+}
+
+// builtinThrow fails with its argument's display form as the message, or
+// rethrows an error caught by try.
+func builtinThrow(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("throw requires exactly one argument")
+	}
+	if err, ok := args[0].(*EvalError); ok {
+		return nil, err
+	}
+	return nil, errors.New(displayString(args[0]))
+}
+
+func builtinIsError(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("error? requires exactly one argument")
+	}
+	_, ok := args[0].(*EvalError)
+	return Boolean(ok), nil
+}
+
+func builtinErrorMessage(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("error-message requires exactly one argument")
+	}
+	err, ok := args[0].(*EvalError)
+	if !ok {
+		return nil, fmt.Errorf("error-message expects an error, got %v", args[0])
+	}
+	return String(err.Err.Error()), nil
+}
+
+// io ------------------------------------------------------------------------------------
+
+func init() {
+	defineBuiltin("io", "slurp", builtinSlurp)
+	defineBuiltin("io", "spit", builtinSpit)
+}
+
+// builtinSlurp returns the contents of a file as a string.
+func builtinSlurp(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("slurp requires exactly one argument")
+	}
+	path, err := toString("slurp", args[0])
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return String(contents), nil
+}
+
+// builtinSpit writes a value's display form to a file, replacing it.
+func builtinSpit(args []Expression, env *Environment) (Expression, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("spit requires exactly two arguments")
+	}
+	path, err := toString("spit", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return nil, os.WriteFile(path, []byte(displayString(args[1])), 0644)
+}
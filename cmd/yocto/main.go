@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/smltr/yocto"
+)
+
+func main() {
+	if len(os.Args) == 1 {
+		if err := yocto.NewREPL(os.Stdout).Run(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if os.Args[1] == "fmt" {
+		os.Exit(fmtCommand(os.Args[2:]))
+	} else if os.Args[1] == "serve" {
+		os.Exit(serveCommand(os.Args[2:]))
+	} else if len(os.Args) == 2 {
+		runFile(os.Args[1])
+	} else {
+		fmt.Println("Usage: yocto [filename.yoc]")
+		fmt.Println("       yocto fmt [-w | -d] filename.yoc...")
+		fmt.Println("       yocto serve [--addr host:port]")
+		os.Exit(1)
+	}
+}
+
+// fmtCommand formats the named files, printing the result, writing it back
+// with -w or printing a diff with -d. It returns the exit status.
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: yocto fmt [-w | -d] filename.yoc...")
+		return 2
+	}
+	status := 0
+	for _, filename := range flags.Args() {
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			status = 1
+			continue
+		}
+		formatted, err := yocto.Format(string(contents))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%v\n", filename, err)
+			status = 1
+			continue
+		}
+		switch {
+		case *diff:
+			fmt.Print(yocto.UnifiedDiff(filename, string(contents), formatted))
+		case *write:
+			if formatted != string(contents) {
+				if err := os.WriteFile(filename, []byte(formatted), 0644); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+					status = 1
+				}
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	return status
+}
+
+// serveCommand runs a REPL server until it fails, returning the exit
+// status.
+func serveCommand(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "127.0.0.1:7888", "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("yocto server listening on %s\n", l.Addr())
+	if err := yocto.NewServer().Serve(l); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runFile(filename string) {
+	if !strings.HasSuffix(filename, ".yoc") {
+		fmt.Println("Error: File must have .yoc extension")
+		os.Exit(1)
+	}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Printf("Error reading file: %v\n", err)
+		os.Exit(1)
+	}
+
+	_, err = yocto.NewInterpreter().Eval(context.Background(), string(contents))
+	if err != nil {
+		fmt.Printf("Error evaluating file: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,218 @@
+package yocto
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Command is a REPL meta-command such as :load. Run receives the text
+// after the command name.
+type Command struct {
+	Name  string
+	Usage string
+	Help  string
+	Run   func(r *REPL, arg string) error
+}
+
+var commands = make(map[string]*Command)
+
+// RegisterCommand adds a meta-command to every REPL, replacing any command
+// with the same name.
+func RegisterCommand(cmd *Command) {
+	commands[cmd.Name] = cmd
+}
+
+func init() {
+	RegisterCommand(&Command{Name: "help", Usage: ":help", Help: "list commands", Run: cmdHelp})
+	RegisterCommand(&Command{Name: "load", Usage: ":load file.yoc", Help: "evaluate a file", Run: cmdLoad})
+	RegisterCommand(&Command{Name: "reload", Usage: ":reload", Help: "evaluate the last loaded file again", Run: cmdReload})
+	RegisterCommand(&Command{Name: "env", Usage: ":env", Help: "list bindings", Run: cmdEnv})
+	RegisterCommand(&Command{Name: "doc", Usage: ":doc name", Help: "describe a binding", Run: cmdDoc})
+	RegisterCommand(&Command{Name: "expand", Usage: ":expand form", Help: "show the macro expansion of a form", Run: cmdExpand})
+	RegisterCommand(&Command{Name: "time", Usage: ":time form", Help: "evaluate a form and show how long it took", Run: cmdTime})
+	RegisterCommand(&Command{Name: "type", Usage: ":type expr", Help: "show the type of a value", Run: cmdType})
+	RegisterCommand(&Command{Name: "trace", Usage: ":trace", Help: "show the traceback of the last error", Run: cmdTrace})
+	RegisterCommand(&Command{Name: "reset", Usage: ":reset", Help: "discard all bindings", Run: cmdReset})
+	RegisterCommand(&Command{Name: "save", Usage: ":save session.yoc", Help: "write the forms evaluated so far to a file", Run: cmdSave})
+	RegisterCommand(&Command{Name: "quit", Usage: ":quit", Help: "leave the REPL", Run: cmdQuit})
+}
+
+func cmdHelp(r *REPL, arg string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%-20s %s\n", commands[name].Usage, commands[name].Help)
+	}
+	return nil
+}
+
+func cmdLoad(r *REPL, arg string) error {
+	if arg == "" {
+		return fmt.Errorf(":load requires a file name")
+	}
+	contents, err := os.ReadFile(arg)
+	if err != nil {
+		return err
+	}
+	r.lastLoad = arg
+	if _, err := r.eval(string(contents)); err != nil {
+		return fmt.Errorf("%s: %v", arg, err)
+	}
+	fmt.Fprintf(r.out, "loaded %s\n", arg)
+	return nil
+}
+
+func cmdReload(r *REPL, arg string) error {
+	if r.lastLoad == "" {
+		return fmt.Errorf("no file has been loaded")
+	}
+	return cmdLoad(r, r.lastLoad)
+}
+
+// cmdEnv lists the bindings made in the session, leaving out *1, *2, *3
+// and *e.
+func cmdEnv(r *REPL, arg string) error {
+	names := make([]string, 0, len(r.env.vars))
+	for name := range r.env.vars {
+		if name != errorVar && !isResultVar(name) {
+			names = append(names, name.String())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%s = %s\n", name, Write(r.env.vars[Intern(name)]))
+	}
+	return nil
+}
+
+func isResultVar(name Name) bool {
+	for _, v := range resultVars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+func cmdDoc(r *REPL, arg string) error {
+	if arg == "" {
+		return fmt.Errorf(":doc requires a name")
+	}
+	for _, form := range specialForms {
+		if form == arg {
+			fmt.Fprintf(r.out, "%s: special form\n", arg)
+			return nil
+		}
+	}
+	name := Intern(arg)
+	value, ok := r.env.Get(name)
+	if !ok {
+		return fmt.Errorf("undefined name: %s", arg)
+	}
+	fmt.Fprintln(r.out, describe(name, value))
+	return nil
+}
+
+// describe returns the signature of a function or macro followed by its
+// docstring, the first form of a body with more than one, if it is a
+// string. Other values are described by their type.
+func describe(name Name, value Expression) string {
+	var params, body List
+	kind := "function"
+	switch v := value.(type) {
+	case *Function:
+		params, body = v.params, v.body
+	case Macro:
+		params, body, kind = v.params, v.body, "macro"
+		if v.restParam != (Name{}) {
+			params = append(append(List{}, params...), Intern("&"), v.restParam)
+		}
+	case *Builtin:
+		return fmt.Sprintf("%s: builtin", name)
+	default:
+		return fmt.Sprintf("%s: %s", name, typeName(value))
+	}
+	doc := fmt.Sprintf("%s: %s", Write(append(List{name}, params...)), kind)
+	if len(body) > 1 {
+		if s, ok := body[0].(String); ok {
+			doc += "\n  " + strings.ReplaceAll(string(s), "\n", "\n  ")
+		}
+	}
+	return doc
+}
+
+func cmdExpand(r *REPL, arg string) error {
+	expr, err := Parse(arg)
+	if err != nil {
+		return err
+	}
+	expanded, _, err := MacroExpand(expr, r.env)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, Pprint(expanded, DefaultWidth))
+	return nil
+}
+
+func cmdTime(r *REPL, arg string) error {
+	start := time.Now()
+	result, err := r.eval(arg)
+	elapsed := time.Since(start)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, Pprint(result, DefaultWidth))
+	fmt.Fprintf(r.out, "elapsed: %v\n", elapsed)
+	return nil
+}
+
+func cmdType(r *REPL, arg string) error {
+	result, err := r.eval(arg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, typeName(result))
+	return nil
+}
+
+func cmdTrace(r *REPL, arg string) error {
+	value, _ := r.env.Get(errorVar)
+	evalErr, ok := value.(*EvalError)
+	if !ok {
+		return fmt.Errorf("no error to trace")
+	}
+	fmt.Fprintln(r.out, evalErr.Traceback())
+	return nil
+}
+
+func cmdReset(r *REPL, arg string) error {
+	r.reset()
+	return nil
+}
+
+// cmdSave writes the session formatted, or as typed if it does not format.
+func cmdSave(r *REPL, arg string) error {
+	if arg == "" {
+		return fmt.Errorf(":save requires a file name")
+	}
+	source := strings.Join(r.session, "\n") + "\n"
+	if formatted, err := Format(source); err == nil {
+		source = formatted
+	}
+	if err := os.WriteFile(arg, []byte(source), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "saved %d forms to %s\n", len(r.session), arg)
+	return nil
+}
+
+func cmdQuit(r *REPL, arg string) error {
+	r.quit = true
+	return nil
+}
@@ -0,0 +1,133 @@
+package yocto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxLCSCells bounds the longest-common-subsequence table diffLines
+// builds, which is quadratic in the number of changed lines.
+const maxLCSCells = 1 << 22
+
+type edit struct {
+	op   byte // ' ', '-' or '+'
+	line string
+	i, j int // positions in x and y before the edit
+}
+
+// UnifiedDiff returns a unified diff from a to b with three lines of
+// context, or "" if they are equal.
+func UnifiedDiff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s.orig\n+++ %s\n", name, name)
+	const context = 3
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		// Extend the hunk while changes are less than two contexts apart.
+		end, gap := start, 0
+		for k := start; k < len(edits) && gap <= 2*context; k++ {
+			if edits[k].op == ' ' {
+				gap++
+			} else {
+				end, gap = k+1, 0
+			}
+		}
+		from, to := max(start-context, 0), min(end+context, len(edits))
+		var removed, added int
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				removed++
+			}
+			if e.op != '-' {
+				added++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", edits[from].i+1, removed, edits[from].j+1, added)
+		for _, e := range edits[from:to] {
+			fmt.Fprintf(&sb, "%c%s\n", e.op, e.line)
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+// diffLines returns the edits that turn x into y. Lines the two share at
+// the start and end are kept; between them it finds the fewest edits,
+// unless that region is too large for the table, when it removes the old
+// lines and adds the new ones.
+func diffLines(x, y []string) []edit {
+	var edits []edit
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		edits = append(edits, edit{' ', x[prefix], prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	xs, ys := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+
+	if (len(xs)+1)*(len(ys)+1) > maxLCSCells {
+		for i, line := range xs {
+			edits = append(edits, edit{'-', line, prefix + i, prefix})
+		}
+		for j, line := range ys {
+			edits = append(edits, edit{'+', line, prefix + len(xs), prefix + j})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of
+		// xs[i:] and ys[j:].
+		lcs := make([][]int, len(xs)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(ys)+1)
+		}
+		for i := len(xs) - 1; i >= 0; i-- {
+			for j := len(ys) - 1; j >= 0; j-- {
+				if xs[i] == ys[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(xs) || j < len(ys) {
+			switch {
+			case i < len(xs) && j < len(ys) && xs[i] == ys[j]:
+				edits = append(edits, edit{' ', xs[i], prefix + i, prefix + j})
+				i, j = i+1, j+1
+			case i < len(xs) && (j == len(ys) || lcs[i+1][j] >= lcs[i][j+1]):
+				edits = append(edits, edit{'-', xs[i], prefix + i, prefix + j})
+				i++
+			default:
+				edits = append(edits, edit{'+', ys[j], prefix + i, prefix + j})
+				j++
+			}
+		}
+	}
+
+	for k := suffix; k > 0; k-- {
+		edits = append(edits, edit{' ', x[len(x)-k], len(x) - k, len(y) - k})
+	}
+	return edits
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\n")
+	}
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
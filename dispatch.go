@@ -0,0 +1,261 @@
+package yocto
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// typeName is the name of a value's type, as type returns it: the record
+// or sum type name for records and variants and a capitalised name for
+// built-in types.
+func typeName(expr Expression) string {
+	switch e := expr.(type) {
+	case nil:
+		return "Nil"
+	case Number:
+		return "Number"
+	case String:
+		return "String"
+	case Char:
+		return "Char"
+	case Boolean:
+		return "Boolean"
+	case Name:
+		return "Symbol"
+	case *Keyword:
+		return "Keyword"
+	case List:
+		return "List"
+	case Vector:
+		return "Vector"
+	case Map:
+		return "Map"
+	case Set:
+		return "Set"
+	case *Regex:
+		return "Regex"
+	case *Function, *Builtin:
+		return "Function"
+	case *Record:
+		return e.typ.name.String()
+	case *VariantValue:
+		return e.variant.typ.name.String()
+	case *EvalError:
+		return "Error"
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", expr), "*yocto.")
+}
+
+// typeKey is the key protocol implementations are stored under: the
+// *RecordType or *SumType of records and variants, so that a record named
+// like a built-in type does not collide with it, and typeName otherwise.
+func typeKey(expr Expression) interface{} {
+	switch e := expr.(type) {
+	case *Record:
+		return e.typ
+	case *VariantValue:
+		return e.variant.typ
+	}
+	return typeName(expr)
+}
+
+var builtinTypeNames = map[string]bool{
+	"Nil": true, "Number": true, "String": true, "Char": true, "Boolean": true, "Symbol": true,
+	"Keyword": true, "List": true, "Vector": true, "Map": true, "Set": true,
+	"Regex": true, "Function": true, "Error": true,
+}
+
+// protocols ---
+
+// Protocol is a named group of methods declared by defprotocol.
+type Protocol struct {
+	name    Name
+	methods []*ProtocolMethod
+}
+
+func (p *Protocol) Evaluate(env *Environment) (Expression, error) {
+	return p, nil
+}
+
+func (p *Protocol) String() string {
+	return fmt.Sprintf("#<protocol %v>", p.name)
+}
+
+func (p *Protocol) method(name Name) *ProtocolMethod {
+	for _, m := range p.methods {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// satisfiedBy reports whether every method has an implementation for the
+// type key.
+func (p *Protocol) satisfiedBy(typ interface{}) bool {
+	for _, m := range p.methods {
+		if _, ok := m.lookup(typ); !ok {
+			return false
+		}
+	}
+	return len(p.methods) > 0
+}
+
+// ProtocolMethod dispatches on the type of its first argument.
+type ProtocolMethod struct {
+	name     Name
+	protocol *Protocol
+	mu       sync.RWMutex
+	impls    map[interface{}]Expression // keyed by typeKey
+}
+
+func (m *ProtocolMethod) Evaluate(env *Environment) (Expression, error) {
+	return m, nil
+}
+
+func (m *ProtocolMethod) String() string {
+	return fmt.Sprintf("#<method %v/%v>", m.protocol.name, m.name)
+}
+
+func (m *ProtocolMethod) lookup(typ interface{}) (Expression, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	fn, ok := m.impls[typ]
+	return fn, ok
+}
+
+func (m *ProtocolMethod) extend(typ interface{}, fn Expression) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.impls[typ] = fn
+}
+
+func (m *ProtocolMethod) call(args []Expression, env *Environment) (Expression, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%v requires at least one argument", m.name)
+	}
+	fn, ok := m.lookup(typeKey(args[0]))
+	if !ok {
+		return nil, fmt.Errorf("no implementation of %v in protocol %v for type %s", m.name, m.protocol.name, typeName(args[0]))
+	}
+	return apply(fn, args, env)
+}
+
+// multimethods ---
+
+var defaultDispatch = InternKeyword("default")
+
+// MultiFn dispatches on the result of applying its dispatch function to
+// the arguments. Methods are keyed by structural equality and matched
+// through the derive hierarchy, falling back to the :default method.
+type MultiFn struct {
+	name     Name
+	dispatch Expression
+	mu       sync.RWMutex
+	methods  Map
+}
+
+func (m *MultiFn) Evaluate(env *Environment) (Expression, error) {
+	return m, nil
+}
+
+func (m *MultiFn) String() string {
+	return fmt.Sprintf("#<multi %v>", m.name)
+}
+
+func (m *MultiFn) addMethod(value, fn Expression) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.methods = m.methods.Assoc(value, fn)
+}
+
+func (m *MultiFn) call(args []Expression, env *Environment) (Expression, error) {
+	value, err := apply(m.dispatch, args, env)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	methods := m.methods
+	m.mu.RUnlock()
+
+	fn, ok := methods.Get(value)
+	if !ok {
+		if fn, err = m.findDerived(env.state, methods, value); err != nil {
+			return nil, err
+		}
+	}
+	if fn == nil {
+		if fn, ok = methods.Get(defaultDispatch); !ok {
+			return nil, fmt.Errorf("no method in multimethod %v for dispatch value %v", m.name, value)
+		}
+	}
+	return apply(fn, args, env)
+}
+
+// findDerived picks the method whose dispatch value is the most specific
+// ancestor of value.
+func (m *MultiFn) findDerived(s *evalState, methods Map, value Expression) (Expression, error) {
+	var bestKey, best Expression
+	var err error
+	methods.Each(func(k, fn Expression) bool {
+		if !s.isa(value, k) {
+			return true
+		}
+		switch {
+		case best == nil || s.isa(k, bestKey):
+			bestKey, best = k, fn
+		case !s.isa(bestKey, k):
+			err = fmt.Errorf("multimethod %v: %v matches both %v and %v, neither is preferred", m.name, value, bestKey, k)
+			return false
+		}
+		return true
+	})
+	return best, err
+}
+
+// hierarchy ---
+
+// derive records parent as a parent of child in the hierarchy of s. Each
+// interpreter has its own hierarchy, shared by its environments.
+func (s *evalState) derive(child, parent Expression) error {
+	if Equal(child, parent) {
+		return fmt.Errorf("cannot derive %v from itself", child)
+	}
+	if s.isa(parent, child) {
+		return fmt.Errorf("cyclic derivation: %v already derives from %v", parent, child)
+	}
+	existing, _ := s.parents.Get(child)
+	set, _ := existing.(Set)
+	s.parents = s.parents.Assoc(child, set.Conj(parent))
+	return nil
+}
+
+// isa reports whether child equals parent, derives from it directly or
+// transitively, or, for vectors, whether each element isa the
+// corresponding element.
+func (s *evalState) isa(child, parent Expression) bool {
+	if Equal(child, parent) {
+		return true
+	}
+	if cv, ok := child.(Vector); ok {
+		pv, ok := parent.(Vector)
+		if !ok || cv.Count() != pv.Count() {
+			return false
+		}
+		for i := 0; i < cv.Count(); i++ {
+			if !s.isa(cv.Nth(i), pv.Nth(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	parents, _ := s.parents.Get(child)
+	set, _ := parents.(Set)
+	found := false
+	set.Each(func(p Expression) bool {
+		found = s.isa(p, parent)
+		return !found
+	})
+	return found
+}
@@ -1,15 +1,87 @@
-package main
+package yocto
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
 
 type Environment struct {
 	vars   map[Name]Expression
 	parent *Environment
+	out    io.Writer // where print and friends write; see Output
+	state  *evalState
+}
+
+// evalState is shared by an environment and every environment created
+// inside it, so all code evaluated there sees the same context.
+type evalState struct {
+	ctx      context.Context
+	limits   Limits
+	deadline time.Time // from limits.Timeout
+	steps    int
+	depth    int
+	allowed  map[Name]*Builtin    // the builtins bound in a sandbox
+	parents  Map                  // the derive hierarchy: child -> Set of parents
+	warned   map[*Expression]bool // match forms already reported by checkExhaustive
+	interned int                  // bytes of names builtins have interned, for MaxAlloc
 }
 
+// builtins returns the builtins bound in environments sharing s: all of
+// them, unless s belongs to a sandbox.
+func (s *evalState) builtins() map[Name]*Builtin {
+	if s.allowed != nil {
+		return s.allowed
+	}
+	return builtins
+}
+
+// ErrInterrupted is returned when the context of an evaluation is done.
+var ErrInterrupted = errors.New("interrupted")
+
+// interruptInterval is how many forms are evaluated between checks of the
+// context.
+const interruptInterval = 1024
+
 func NewEnvironment(parent *Environment) *Environment {
-	return &Environment{
+	env := &Environment{
 		vars:   make(map[Name]Expression),
 		parent: parent,
 	}
+	if parent != nil {
+		env.state = parent.state
+	} else {
+		env.state = &evalState{}
+	}
+	return env
+}
+
+// SetContext makes evaluation in env, and in environments created inside
+// it, stop with ErrInterrupted once ctx is done. A nil ctx never stops.
+func (env *Environment) SetContext(ctx context.Context) {
+	env.state.ctx = ctx
+}
+
+// step is called for every form evaluated. It enforces the step limit and,
+// every interruptInterval steps, the timeout and the context.
+func (env *Environment) step() error {
+	s := env.state
+	s.steps++
+	if s.limits.MaxSteps > 0 && s.steps > s.limits.MaxSteps {
+		return &StepLimitError{Limit: s.limits.MaxSteps}
+	}
+	if s.steps%interruptInterval != 0 {
+		return nil
+	}
+	if !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		return &TimeoutError{Limit: s.limits.Timeout}
+	}
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return nil
 }
 
 func (env *Environment) Get(name Name) (Expression, bool) {
@@ -19,9 +91,48 @@ func (env *Environment) Get(name Name) (Expression, bool) {
 	if env.parent != nil {
 		return env.parent.Get(name)
 	}
+	if b, ok := env.state.builtins()[name]; ok {
+		return b, true
+	}
 	return nil, false
 }
 
 func (env *Environment) Set(name Name, value Expression) {
 	env.vars[name] = value
 }
+
+// Output returns the writer set on env or the nearest environment above it,
+// or os.Stdout.
+func (env *Environment) Output() io.Writer {
+	for e := env; e != nil; e = e.parent {
+		if e.out != nil {
+			return e.out
+		}
+	}
+	return os.Stdout
+}
+
+// SetOutput sends the output of code evaluated in env, and in environments
+// created inside it, to w.
+func (env *Environment) SetOutput(w io.Writer) {
+	env.out = w
+}
+
+// Names returns every name visible from env, including builtins, in no
+// particular order.
+func (env *Environment) Names() []Name {
+	seen := make(map[Name]bool)
+	for e := env; e != nil; e = e.parent {
+		for name := range e.vars {
+			seen[name] = true
+		}
+	}
+	for name := range env.state.builtins() {
+		seen[name] = true
+	}
+	names := make([]Name, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,227 @@
+package yocto
+
+import (
+	"strings"
+)
+
+// cstNode is a node of the concrete syntax tree the formatter works on.
+// Unlike the expressions parseExpr builds it keeps comments and the source
+// text of every atom, so formatting never changes what a file means.
+type cstNode struct {
+	tok      Token      // the atom, comment, opening bracket, quote or #_
+	children []*cstNode // the forms inside brackets, or after a quote or #_
+	close    Token      // the closing bracket
+}
+
+func (n *cstNode) isComment() bool {
+	return n.tok.Kind == TokenComment
+}
+
+func (n *cstNode) startLine() int {
+	return n.tok.Line
+}
+
+func (n *cstNode) endLine() int {
+	switch {
+	case n.tok.Kind == TokenOpen:
+		return n.close.Line
+	case len(n.children) > 0:
+		return n.children[len(n.children)-1].endLine()
+	}
+	return n.tok.Line + strings.Count(n.tok.Text, "\n")
+}
+
+// parseCST reads every top-level form and comment in input.
+func parseCST(input string) ([]*cstNode, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*cstNode
+	for len(tokens) > 0 {
+		var node *cstNode
+		node, tokens, err = parseCSTNode(tokens)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func parseCSTNode(tokens []Token) (*cstNode, []Token, error) {
+	node := &cstNode{tok: tokens[0]}
+	tokens = tokens[1:]
+	switch node.tok.Kind {
+	case TokenOpen:
+		closing := closerFor(node.tok.Text)
+		for len(tokens) > 0 && tokens[0].Kind != TokenClose {
+			child, remaining, err := parseCSTNode(tokens)
+			if err != nil {
+				return nil, remaining, err
+			}
+			node.children = append(node.children, child)
+			tokens = remaining
+		}
+		if len(tokens) == 0 {
+			return nil, tokens, syntaxError(node.tok, "missing closing "+closingNames[closing])
+		}
+		if tokens[0].Text != closing {
+			return nil, tokens, syntaxError(tokens[0], "unexpected closing "+closingNames[tokens[0].Text])
+		}
+		node.close = tokens[0]
+		return node, tokens[1:], nil
+	case TokenClose:
+		return nil, tokens, syntaxError(node.tok, "unexpected closing "+closingNames[node.tok.Text])
+	case TokenQuote, TokenDatumComment:
+		// Comments between a prefix and its form stay with the prefix.
+		for {
+			if len(tokens) == 0 {
+				return nil, tokens, syntaxError(node.tok, "unexpected EOF after "+node.tok.Text)
+			}
+			child, remaining, err := parseCSTNode(tokens)
+			if err != nil {
+				return nil, remaining, err
+			}
+			node.children = append(node.children, child)
+			tokens = remaining
+			if !child.isComment() {
+				return node, tokens, nil
+			}
+		}
+	}
+	return node, tokens, nil
+}
+
+// Format returns source laid out in the canonical style: bodies are
+// indented by two, arguments are aligned, forms too long for a line are
+// broken as pprint breaks them, and comments, line breaks and single blank
+// lines between forms are kept.
+func Format(source string) (string, error) {
+	nodes, err := parseCST(source)
+	if err != nil {
+		return "", err
+	}
+	if len(nodes) == 0 {
+		return "", nil
+	}
+	var sb strings.Builder
+	renderDoc(&sb, docConcat{joinNodes(nodes, nil), docHardLine{}}, DefaultWidth)
+	return sb.String(), nil
+}
+
+func nodeDoc(n *cstNode) doc {
+	switch n.tok.Kind {
+	case TokenOpen:
+		return formDoc(n)
+	case TokenQuote, TokenDatumComment:
+		d := docConcat{docText(n.tok.Text)}
+		for _, child := range n.children {
+			d = append(d, nodeDoc(child))
+			if child.isComment() {
+				d = append(d, docHardLine{})
+			}
+		}
+		return d
+	}
+	return docText(n.tok.Text)
+}
+
+// separator returns what goes between two neighbouring nodes. Line breaks
+// in the source are kept, with at most one empty line, and a comment
+// always ends its line. Otherwise it is a line break that a group may
+// render flat.
+func separator(prev, next *cstNode) doc {
+	switch {
+	case next.startLine()-prev.endLine() > 1:
+		return docConcat{docHardLine{}, docHardLine{}}
+	case prev.isComment() || next.startLine() > prev.endLine():
+		return docHardLine{}
+	case next.isComment():
+		return docText(" ")
+	}
+	return docLine{}
+}
+
+// joinNodes joins nodes with their separators. If prev is not nil the
+// result starts with the separator after it.
+func joinNodes(nodes []*cstNode, prev *cstNode) doc {
+	d := docConcat{}
+	for _, node := range nodes {
+		if prev != nil {
+			d = append(d, separator(prev, node))
+		}
+		d = append(d, nodeDoc(node))
+		prev = node
+	}
+	return d
+}
+
+// formDoc lays out a bracketed form the way listDoc does, keeping the
+// leading arguments of body forms on the first line.
+func formDoc(n *cstNode) doc {
+	items := n.children
+	if len(items) == 0 {
+		return docText(n.tok.Text + n.close.Text)
+	}
+	var close doc = docText(n.close.Text)
+	if last := items[len(items)-1]; last.isComment() {
+		close = docConcat{docHardLine{}, close}
+	}
+	if n.tok.Text == "(" && items[0].tok.Kind == TokenSymbol {
+		head := items[0]
+		if count, body := bodyForms[head.tok.Text]; body && len(items) > count+1 && !hasComment(items[:count+1]) {
+			header := docConcat{docText("(" + head.tok.Text)}
+			for _, arg := range items[1 : count+1] {
+				header = append(header, docText(" "), nodeDoc(arg))
+			}
+			rest := joinNodes(items[count+1:], items[count])
+			return docGroup{docConcat{header, docNest{2, rest}, close}}
+		}
+		if len(items) > 1 && !items[1].isComment() {
+			return docGroup{docConcat{docText("(" + head.tok.Text + " "), docAlign{joinNodes(items[1:], nil)}, close}}
+		}
+	}
+	if strings.HasSuffix(n.tok.Text, "{") && n.tok.Text != "#{" {
+		return docGroup{docConcat{docText(n.tok.Text), docAlign{joinEntries(items)}, close}}
+	}
+	return docGroup{docConcat{docText(n.tok.Text), docAlign{joinNodes(items, nil)}, close}}
+}
+
+// joinEntries joins the keys and values of a map or record literal,
+// keeping each key with its value as entryDoc does.
+func joinEntries(nodes []*cstNode) doc {
+	d := docConcat{}
+	var prev *cstNode
+	key := true
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if prev != nil {
+			d = append(d, separator(prev, node))
+		}
+		prev = node
+		if node.isComment() {
+			d = append(d, nodeDoc(node))
+			continue
+		}
+		if key && i+1 < len(nodes) && !nodes[i+1].isComment() {
+			value := nodes[i+1]
+			d = append(d, docGroup{docConcat{nodeDoc(node), docNest{2, docConcat{separator(node, value), nodeDoc(value)}}}})
+			prev = value
+			i++
+			continue
+		}
+		d = append(d, nodeDoc(node))
+		key = !key
+	}
+	return d
+}
+
+func hasComment(nodes []*cstNode) bool {
+	for _, node := range nodes {
+		if node.isComment() {
+			return true
+		}
+	}
+	return false
+}
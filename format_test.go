@@ -0,0 +1,101 @@
+package yocto
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Reindents bodies and closes dangling parens",
+			input:    "(defn (f n)\n(if (<= n 1)\n      n\n          (f (- n 1)))\n\n  )\n",
+			expected: "(defn (f n)\n  (if (<= n 1)\n    n\n    (f (- n 1))))\n",
+		},
+		{
+			name:     "Collapses stray whitespace",
+			input:    "(print   (+ 1    2) )",
+			expected: "(print (+ 1 2))\n",
+		},
+		{
+			name:     "Keeps comments and one blank line",
+			input:    "; about f\n(def x 1) ; one\n\n\n\n#| block |#\n(def y #_ 2 3)",
+			expected: "; about f\n(def x 1) ; one\n\n#| block |#\n(def y #_2 3)\n",
+		},
+		{
+			name:     "Aligns arguments and map entries",
+			input:    "(+ a\nb c)\n{:a 1 ; first\n:b 2}",
+			expected: "(+ a\n   b\n   c)\n{:a 1 ; first\n :b 2}\n",
+		},
+		{
+			name:     "Keeps atoms as written",
+			input:    `(list #"raw\n" "a\tb" #\space #/a\/b/ 1.50)`,
+			expected: "(list #\"raw\\n\" \"a\\tb\" #\\space #/a\\/b/ 1.50)\n",
+		},
+		{
+			name:     "Breaks long lines",
+			input:    "(defn (long-function-name argument-one argument-two) (some-function argument-one (another-function argument-two)))",
+			expected: "(defn (long-function-name argument-one argument-two)\n  (some-function argument-one (another-function argument-two)))\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Format(tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.expected, result)
+			}
+			if again, _ := Format(result); again != result {
+				t.Errorf("Formatting is not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	for _, input := range []string{"(def x", "(def x]", ")", "'"} {
+		if _, err := Format(input); err == nil {
+			t.Errorf("Expected an error formatting %q", input)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	diff := UnifiedDiff("a.yoc", "(a)\n(b)\n", "(a)\n(c)\n")
+	expected := "--- a.yoc.orig\n+++ a.yoc\n@@ -1,2 +1,2 @@\n (a)\n-(b)\n+(c)\n"
+	if diff != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, diff)
+	}
+}
+
+func TestUnifiedDiffLarge(t *testing.T) {
+	var a, b, c strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&a, "(a %d)\n", i)
+		if i == 5000 {
+			b.WriteString("(changed)\n")
+		} else {
+			fmt.Fprintf(&b, "(a %d)\n", i)
+		}
+		fmt.Fprintf(&c, "(c %d)\n", i)
+	}
+	diff := UnifiedDiff("a.yoc", a.String(), b.String())
+	expected := "--- a.yoc.orig\n+++ a.yoc\n@@ -4998,7 +4998,7 @@\n (a 4997)\n (a 4998)\n (a 4999)\n-(a 5000)\n+(changed)\n (a 5001)\n (a 5002)\n (a 5003)\n"
+	if diff != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, diff)
+	}
+
+	// Too many changed lines for the table: one hunk replaces them all.
+	diff = UnifiedDiff("a.yoc", a.String(), c.String())
+	if !strings.HasPrefix(diff, "--- a.yoc.orig\n+++ a.yoc\n@@ -1,10000 +1,10000 @@\n-(a 0)\n") || strings.Count(diff, "\n") != 20003 {
+		t.Errorf("Expected a single hunk replacing every line, got %.100q", diff)
+	}
+}
@@ -0,0 +1,389 @@
+package yocto
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterFunc binds name to the Go function fn. Arguments are converted
+// to fn's parameter types as toGoValue describes and results back with
+// ToExpression: none gives nil, several give a vector. If fn's last
+// result is an error, a non-nil one fails the call with an error try can
+// catch. If fn's first parameter is a context.Context it receives the
+// context of the evaluation. Variadic functions take any number of
+// trailing arguments.
+//
+// The record types of the structs in fn's signature are bound as
+// defrecord binds them, named in kebab case: a Response parameter binds
+// response, response?, response-status-code and so on. It is an error,
+// and nothing is bound, if one of those names is already taken, such as
+// vector by a struct named Vector or by another struct of the same name
+// from a different package.
+func (in *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	b, err := goFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	var types []*RecordType
+	t := reflect.TypeOf(fn)
+	for i := 0; i < t.NumIn(); i++ {
+		types = appendStructType(types, t.In(i))
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		types = appendStructType(types, t.Out(i))
+	}
+	taken := make(map[string]*RecordType)
+	for _, typ := range types {
+		for _, bound := range recordNames(typ) {
+			if other, ok := taken[bound]; ok && other != typ {
+				return fmt.Errorf("%s: record types %v and %v both bind %s", name, other.name, typ.name, bound)
+			}
+			taken[bound] = typ
+		}
+		if err := checkRecordNames(typ, in.env); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	in.env.Set(Intern(name), b)
+	for _, typ := range types {
+		bindRecordType(typ, in.env)
+	}
+	return nil
+}
+
+// appendStructType appends the record type of t to types if t is a struct
+// or a pointer, slice or array of them.
+func appendStructType(types []*RecordType, t reflect.Type) []*RecordType {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return types
+	}
+	typ := recordFor(t).typ
+	for _, existing := range types {
+		if existing == typ {
+			return types
+		}
+	}
+	return append(types, typ)
+}
+
+// recordNames returns the names bindRecordType binds for typ.
+func recordNames(typ *RecordType) []string {
+	names := []string{typ.name.String(), typ.name.String() + "?"}
+	for _, field := range typ.fields {
+		names = append(names, typ.name.String()+"-"+field.name)
+	}
+	return names
+}
+
+// checkRecordNames returns an error if binding typ in env would rebind a
+// name bound to something else. Binding typ again, for another function
+// using the same struct, is allowed.
+func checkRecordNames(typ *RecordType, env *Environment) error {
+	if bound, _ := env.Get(typ.name); bound == Expression(typ) {
+		return nil
+	}
+	for _, name := range recordNames(typ) {
+		if _, ok := env.Get(Intern(name)); ok {
+			return fmt.Errorf("cannot bind record type %v: %s is already defined", typ.name, name)
+		}
+	}
+	return nil
+}
+
+// goFunc wraps fn in a builtin.
+func goFunc(name string, fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s: %T is not a function", name, fn)
+	}
+	t := v.Type()
+	takesContext := t.NumIn() > 0 && t.In(0) == contextType
+	var params []reflect.Type
+	for i := 0; i < t.NumIn(); i++ {
+		if i > 0 || !takesContext {
+			params = append(params, t.In(i))
+		}
+	}
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	return &Builtin{
+		name: name,
+		fn: func(args []Expression, env *Environment) (Expression, error) {
+			switch {
+			case t.IsVariadic() && len(args) < len(params)-1:
+				return nil, fmt.Errorf("%s requires at least %d arguments", name, len(params)-1)
+			case !t.IsVariadic() && len(args) != len(params):
+				return nil, fmt.Errorf("%s requires exactly %d arguments", name, len(params))
+			}
+			var in []reflect.Value
+			if takesContext {
+				ctx := env.state.ctx
+				if ctx == nil {
+					ctx = context.Background()
+				}
+				in = append(in, reflect.ValueOf(ctx))
+			}
+			for i, arg := range args {
+				var param reflect.Type
+				if t.IsVariadic() && i >= len(params)-1 {
+					param = params[len(params)-1].Elem()
+				} else {
+					param = params[i]
+				}
+				value, err := toGoValue(arg, param)
+				if err != nil {
+					return nil, fmt.Errorf("%s: argument %d: %w", name, i+1, err)
+				}
+				in = append(in, value)
+			}
+
+			out, err := callGo(name, v, in)
+			if err != nil {
+				return nil, err
+			}
+			if returnsError {
+				if err, _ := out[len(out)-1].Interface().(error); err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				out = out[:len(out)-1]
+			}
+			switch len(out) {
+			case 0:
+				return nil, nil
+			case 1:
+				return ToExpression(out[0].Interface())
+			}
+			results := make([]Expression, len(out))
+			for i, value := range out {
+				result, err := ToExpression(value.Interface())
+				if err != nil {
+					return nil, err
+				}
+				results[i] = result
+			}
+			return NewVector(results...), nil
+		},
+	}, nil
+}
+
+// callGo calls fn, turning a panic into an error.
+func callGo(name string, fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s panicked: %v", name, r)
+		}
+	}()
+	return fn.Call(in), nil
+}
+
+// toGoValue converts expr to a value of type t, undoing ToExpression.
+// Numbers convert to any numeric type they fit, strings, symbols and
+// keywords to strings or byte slices, lists, vectors and sets to slices,
+// maps to maps or structs, and records to the structs they were made from.
+// Parameters of an Expression type take expr as it is, and interface{}
+// parameters take FromExpression of it.
+func toGoValue(expr Expression, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		value := reflect.New(t).Elem()
+		if v := FromExpression(expr); v != nil {
+			value.Set(reflect.ValueOf(v))
+		}
+		return value, nil
+	}
+	if expr != nil && reflect.TypeOf(expr).AssignableTo(t) {
+		return reflect.ValueOf(expr), nil
+	}
+	value := reflect.New(t).Elem()
+	switch e := expr.(type) {
+	case nil:
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return value, nil
+		}
+	case Boolean:
+		if t.Kind() == reflect.Bool {
+			value.SetBool(bool(e))
+			return value, nil
+		}
+	case Number:
+		n := float64(e)
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// Range-check n as a float: converting one out of range to
+			// int64 saturates rather than failing.
+			limit := math.Ldexp(1, t.Bits()-1)
+			if n == math.Trunc(n) && n >= -limit && n < limit {
+				value.SetInt(int64(n))
+				return value, nil
+			}
+			return value, fmt.Errorf("%v does not fit in %v", Write(e), t)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if n == math.Trunc(n) && n >= 0 && n < math.Ldexp(1, t.Bits()) {
+				value.SetUint(uint64(n))
+				return value, nil
+			}
+			return value, fmt.Errorf("%v does not fit in %v", Write(e), t)
+		case reflect.Float32, reflect.Float64:
+			value.SetFloat(n)
+			return value, nil
+		}
+	case String, Name, *Keyword:
+		s := FromExpression(e).(string)
+		switch {
+		case t.Kind() == reflect.String:
+			value.SetString(s)
+			return value, nil
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+			value.SetBytes([]byte(s))
+			return value, nil
+		}
+	case Map:
+		switch t.Kind() {
+		case reflect.Map:
+			return toGoMap(e, t)
+		case reflect.Struct:
+			sr := recordFor(t)
+			for i, field := range sr.typ.fields {
+				item, ok := e.Get(field)
+				if !ok {
+					continue
+				}
+				v, err := toGoValue(item, t.Field(sr.fields[i]).Type)
+				if err != nil {
+					return value, fmt.Errorf("%v: %w", field, err)
+				}
+				value.Field(sr.fields[i]).Set(v)
+			}
+			return value, nil
+		}
+	case *Record:
+		if t.Kind() == reflect.Struct && e.typ == recordFor(t).typ {
+			for i, index := range recordFor(t).fields {
+				v, err := toGoValue(e.values[i], t.Field(index).Type)
+				if err != nil {
+					return value, fmt.Errorf("%v: %w", e.typ.fields[i], err)
+				}
+				value.Field(index).Set(v)
+			}
+			return value, nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := toGoValue(expr, t.Elem())
+		if err != nil {
+			return value, err
+		}
+		value.Set(reflect.New(t.Elem()))
+		value.Elem().Set(elem)
+		return value, nil
+	case reflect.Slice:
+		var items []Expression
+		if set, ok := expr.(Set); ok {
+			set.Each(func(item Expression) bool {
+				items = append(items, item)
+				return true
+			})
+		} else if items, ok = toSlice(expr); !ok {
+			break
+		}
+		value.Set(reflect.MakeSlice(t, len(items), len(items)))
+		for i, item := range items {
+			v, err := toGoValue(item, t.Elem())
+			if err != nil {
+				return value, fmt.Errorf("item %d: %w", i, err)
+			}
+			value.Index(i).Set(v)
+		}
+		return value, nil
+	}
+	return value, fmt.Errorf("cannot use %s as %v", Write(expr), t)
+}
+
+func toGoMap(m Map, t reflect.Type) (reflect.Value, error) {
+	value := reflect.MakeMapWithSize(t, m.Count())
+	var err error
+	m.Each(func(k, v Expression) bool {
+		var key, elem reflect.Value
+		if key, err = toGoValue(k, t.Key()); err != nil {
+			return false
+		}
+		if elem, err = toGoValue(v, t.Elem()); err != nil {
+			return false
+		}
+		value.SetMapIndex(key, elem)
+		return true
+	})
+	return value, err
+}
+
+// structRecord is the record type standing for a Go struct type.
+type structRecord struct {
+	typ    *RecordType
+	fields []int // the struct field index of each record field
+}
+
+// structRecords caches the structRecord of each struct type, so that all
+// values of a struct type convert to records of one type.
+var structRecords sync.Map
+
+// recordFor returns the record type for the struct type t. It is named
+// after t and has a field for each exported field of t, in kebab case
+// unless a yocto tag names it. Fields tagged yocto:"-" are left out.
+func recordFor(t reflect.Type) *structRecord {
+	if sr, ok := structRecords.Load(t); ok {
+		return sr.(*structRecord)
+	}
+	name := kebabCase(t.Name())
+	if name == "" {
+		name = "struct"
+	}
+	sr := &structRecord{typ: &RecordType{name: Intern(name)}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("yocto")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = kebabCase(field.Name)
+		}
+		sr.typ.fields = append(sr.typ.fields, InternKeyword(tag))
+		sr.fields = append(sr.fields, i)
+	}
+	actual, _ := structRecords.LoadOrStore(t, sr)
+	return actual.(*structRecord)
+}
+
+// kebabCase turns a Go name such as StatusCode or HTTPServer into
+// status-code or http-server.
+func kebabCase(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prev := runes[max(i-1, 0)]
+			if i > 0 && (unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				sb.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,172 @@
+package yocto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testResponse struct {
+	StatusCode int
+	Body       []byte
+	Headers    map[string]string
+	secret     string
+}
+
+var errNotFound = errors.New("not found")
+
+func TestRegisterFunc(t *testing.T) {
+	in := NewInterpreter()
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "from-ctx")
+
+	funcs := map[string]interface{}{
+		"http-get": func(ctx context.Context, url string) (*testResponse, error) {
+			if !strings.HasPrefix(url, "http://") {
+				return nil, errNotFound
+			}
+			return &testResponse{
+				StatusCode: 200,
+				Body:       []byte(ctx.Value(ctxKey{}).(string)),
+				Headers:    map[string]string{"a": "b"},
+			}, nil
+		},
+		"sum": func(base float64, xs ...int) float64 {
+			for _, x := range xs {
+				base += float64(x)
+			}
+			return base
+		},
+		"join":   func(parts []string, sep string) string { return strings.Join(parts, sep) },
+		"status": func(r testResponse) int { return r.StatusCode },
+		"divmod": func(a, b int) (int, int) { return a / b, a % b },
+		"lookup": func(m map[string]int, key string) (int, bool) { v, ok := m[key]; return v, ok },
+		"boom":   func() { panic("oops") },
+		"any":    func(v interface{}) string { return fmt.Sprint(v) },
+		"id64":   func(n int64) int64 { return n },
+		"id8":    func(n int8) int8 { return n },
+		"idu":    func(n uint) uint { return n },
+	}
+	for name, fn := range funcs {
+		if err := in.RegisterFunc(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := in.RegisterFunc("bad", 3); err == nil {
+		t.Error("RegisterFunc(bad, 3) succeeded")
+	}
+
+	tests := []struct {
+		input, expected string
+	}{
+		{`(def r (http-get "http://x")) (test-response-status-code r)`, "200"},
+		{`(:body r)`, `"from-ctx"`},
+		{`(get (:headers r) "a")`, `"b"`},
+		{`(test-response? r)`, "true"},
+		{`(status r)`, "200"},
+		{`(status {:status-code 404})`, "404"},
+		{`(status (test-response 500 "" {}))`, "500"},
+		{`(try (http-get "ftp://x") (catch e (error-message e)))`, `"http-get: not found"`},
+		{`(sum 1)`, "1"},
+		{`(sum 1 2 3)`, "6"},
+		{`(join '(a b) ", ")`, `"a, b"`},
+		{`(join ["x" :y] "")`, `"xy"`},
+		{`(divmod 7 2)`, "[3 1]"},
+		{`(lookup {"a" 1} "a")`, "[1 true]"},
+		{`(try (boom) (catch e (error-message e)))`, `"boom panicked: oops"`},
+		{`(any [1 "a"])`, "\"[1 a]\""},
+		{`(id64 -9223372036854775808)`, "-9223372036854776000"},
+		{`(id8 -128)`, "-128"},
+		{`(idu 18446744073709549568)`, "18446744073709550000"},
+	}
+	for _, tt := range tests {
+		result, err := in.Eval(ctx, tt.input)
+		if err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		if got := Write(result); got != tt.expected {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input, expected string
+	}{
+		{`(sum)`, "sum requires at least 1 arguments"},
+		{`(divmod 1)`, "divmod requires exactly 2 arguments"},
+		{`(divmod 1.5 1)`, "divmod: argument 1: 1.5 does not fit in int"},
+		{`(join "a" "")`, `join: argument 1: cannot use "a" as []string`},
+		{`(http-get "ftp://x")`, "http-get: not found"},
+		{`(id64 1e19)`, "id64: argument 1: 10000000000000000000 does not fit in int64"},
+		{`(id64 9223372036854775808)`, "id64: argument 1: 9223372036854776000 does not fit in int64"},
+		{`(id64 ##Inf)`, "id64: argument 1: ##Inf does not fit in int64"},
+		{`(id64 -1e30)`, "id64: argument 1: -1e+30 does not fit in int64"},
+		{`(id8 128)`, "id8: argument 1: 128 does not fit in int8"},
+		{`(idu 1e20)`, "idu: argument 1: 100000000000000000000 does not fit in uint"},
+		{`(idu 18446744073709551616)`, "idu: argument 1: 18446744073709552000 does not fit in uint"},
+		{`(idu -1)`, "idu: argument 1: -1 does not fit in uint"},
+	}
+	for _, tt := range errorTests {
+		_, err := in.Eval(ctx, tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: got error %v, want %s", tt.input, err, tt.expected)
+		}
+	}
+	if _, err := in.Eval(ctx, `(http-get "ftp://x")`); !errors.Is(err, errNotFound) {
+		t.Errorf("got %v, want it to wrap errNotFound", err)
+	}
+}
+
+func TestRegisterFuncNameCollisions(t *testing.T) {
+	in := NewInterpreter()
+	type Vector struct{ X int }
+	err := in.RegisterFunc("make-vec", func() Vector { return Vector{} })
+	if err == nil || err.Error() != "make-vec: cannot bind record type vector: vector is already defined" {
+		t.Errorf("Got %v, want an error naming vector", err)
+	}
+	if _, ok := in.Lookup("make-vec"); ok {
+		t.Error("make-vec was bound despite the error")
+	}
+	if result, err := in.Eval(context.Background(), "(vector 1 2)"); err != nil || Write(result) != "[1 2]" {
+		t.Errorf("(vector 1 2) = %v, %v", result, err)
+	}
+
+	type Point struct{ X int }
+	type outerPoint = Point
+	px := func(p Point) int { return p.X }
+	if err := in.RegisterFunc("px", px); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.RegisterFunc("px-again", px); err != nil {
+		t.Errorf("Registering a second function on the same struct: %v", err)
+	}
+	{
+		// A struct of the same name from elsewhere.
+		type Point struct{ Y int }
+		err := in.RegisterFunc("py", func(p Point) int { return p.Y })
+		if err == nil || err.Error() != "py: cannot bind record type point: point is already defined" {
+			t.Errorf("Got %v, want an error naming point", err)
+		}
+		err = NewInterpreter().RegisterFunc("both", func(a outerPoint, b Point) {})
+		if err == nil || err.Error() != "both: record types point and point both bind point" {
+			t.Errorf("Got %v, want a conflict between the two points", err)
+		}
+	}
+}
+
+func TestKebabCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"StatusCode": "status-code",
+		"HTTPServer": "http-server",
+		"UserID":     "user-id",
+		"URL":        "url",
+		"Page2Size":  "page2-size",
+	} {
+		if got := kebabCase(name); got != want {
+			t.Errorf("kebabCase(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package yocto
+
+import (
+	"hash/fnv"
+	"math"
+	"reflect"
+)
+
+// Equal reports whether two expressions are structurally equal. It is the
+// equality used by = and by hash map keys.
+func Equal(a, b Expression) bool {
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case Number, String, Char, Name, Boolean:
+		return a == b
+	case List:
+		y, ok := b.(List)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !Equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case Vector:
+		y, ok := b.(Vector)
+		if !ok || x.Count() != y.Count() {
+			return false
+		}
+		for i := 0; i < x.Count(); i++ {
+			if !Equal(x.Nth(i), y.Nth(i)) {
+				return false
+			}
+		}
+		return true
+	case Set:
+		y, ok := b.(Set)
+		if !ok || x.Count() != y.Count() {
+			return false
+		}
+		equal := true
+		x.Each(func(item Expression) bool {
+			equal = y.Contains(item)
+			return equal
+		})
+		return equal
+	case *Record:
+		y, ok := b.(*Record)
+		if !ok || x.typ != y.typ {
+			return false
+		}
+		for i := range x.values {
+			if !Equal(x.values[i], y.values[i]) {
+				return false
+			}
+		}
+		return true
+	case *VariantValue:
+		y, ok := b.(*VariantValue)
+		if !ok || x.variant != y.variant {
+			return false
+		}
+		for i := range x.values {
+			if !Equal(x.values[i], y.values[i]) {
+				return false
+			}
+		}
+		return true
+	case *Regex:
+		y, ok := b.(*Regex)
+		return ok && x.re.String() == y.re.String()
+	case Map:
+		y, ok := b.(Map)
+		if !ok || x.Count() != y.Count() {
+			return false
+		}
+		equal := true
+		x.Each(func(k, v Expression) bool {
+			other, found := y.Get(k)
+			equal = found && Equal(v, other)
+			return equal
+		})
+		return equal
+	}
+	if b == nil || !reflect.TypeOf(a).Comparable() || !reflect.TypeOf(b).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// Hash returns a hash of expr consistent with Equal: structurally equal
+// expressions always hash to the same value.
+func Hash(expr Expression) uint32 {
+	switch e := expr.(type) {
+	case nil:
+		return 0
+	case Number:
+		f := float64(e)
+		if f == 0 {
+			f = 0 // fold -0 into 0
+		}
+		return hashBytes('n', uint64Bytes(math.Float64bits(f)))
+	case String:
+		return hashBytes('s', []byte(e))
+	case Name:
+		return e.id * 2654435761
+	case Char:
+		return uint32(e) * 2246822519
+	case *Keyword:
+		return hashBytes('k', []byte(e.name))
+	case Boolean:
+		if e {
+			return 1231
+		}
+		return 1237
+	case List:
+		h := uint32(1)
+		for _, item := range e {
+			h = 31*h + Hash(item)
+		}
+		return h
+	case Vector:
+		h := uint32(7)
+		for i := 0; i < e.Count(); i++ {
+			h = 31*h + Hash(e.Nth(i))
+		}
+		return h
+	case Set:
+		h := uint32(11)
+		e.Each(func(item Expression) bool {
+			h += Hash(item)
+			return true
+		})
+		return h
+	case *Record:
+		h := Hash(e.typ.name)
+		for _, value := range e.values {
+			h = 31*h + Hash(value)
+		}
+		return h
+	case *VariantValue:
+		h := Hash(e.variant.name)
+		for _, value := range e.values {
+			h = 31*h + Hash(value)
+		}
+		return h
+	case *Regex:
+		return hashBytes('r', []byte(e.re.String()))
+	case Map:
+		// Entries are combined with + so the result is independent of
+		// iteration order.
+		var h uint32
+		e.Each(func(k, v Expression) bool {
+			h += Hash(k) ^ (Hash(v) * 16777619)
+			return true
+		})
+		return h
+	}
+	return hashBytes('?', []byte(reflect.TypeOf(expr).String()))
+}
+
+func hashBytes(tag byte, b []byte) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte{tag})
+	h.Write(b)
+	return h.Sum32()
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	for i := range b {
+		b[i] = byte(v >> (8 * i))
+	}
+	return b
+}
@@ -0,0 +1,362 @@
+package yocto
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Map is an immutable hash array mapped trie keyed by Equal and Hash.
+// The zero value is an empty map.
+type Map struct {
+	root  hamtNode
+	count int
+}
+
+// Evaluate evaluates every key and value, so literals like {k (+ 1 2)}
+// produce maps of values.
+func (m Map) Evaluate(env *Environment) (Expression, error) {
+	t := Map{}.Transient()
+	var err error
+	m.Each(func(k, v Expression) bool {
+		var key, val Expression
+		if key, err = evaluate(k, env); err != nil {
+			return false
+		}
+		if val, err = evaluate(v, env); err != nil {
+			return false
+		}
+		count := t.count
+		t.Assoc(key, val)
+		if t.count == count {
+			err = fmt.Errorf("duplicate key %s in map literal", Write(key))
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.Persistent(), nil
+}
+
+func (m Map) String() string {
+	return Write(m)
+}
+
+func (m Map) Count() int {
+	return m.count
+}
+
+func (m Map) Get(key Expression) (Expression, bool) {
+	if m.root == nil {
+		return nil, false
+	}
+	return m.root.find(0, Hash(key), key)
+}
+
+func (m Map) Assoc(key, val Expression) Map {
+	var root hamtNode = &bitmapNode{}
+	if m.root != nil {
+		root = m.root
+	}
+	added := false
+	root = root.assoc(nil, 0, Hash(key), key, val, &added)
+	if added {
+		return Map{root: root, count: m.count + 1}
+	}
+	return Map{root: root, count: m.count}
+}
+
+func (m Map) Dissoc(key Expression) Map {
+	if m.root == nil {
+		return m
+	}
+	removed := false
+	root := m.root.dissoc(nil, 0, Hash(key), key, &removed)
+	if !removed {
+		return m
+	}
+	return Map{root: root, count: m.count - 1}
+}
+
+// Each calls fn for every entry until fn returns false.
+func (m Map) Each(fn func(k, v Expression) bool) {
+	if m.root != nil {
+		m.root.each(fn)
+	}
+}
+
+// Transient returns a builder that updates a copy of m in place.
+func (m Map) Transient() *TransientMap {
+	return &TransientMap{root: m.root, count: m.count, edit: &editToken{}}
+}
+
+// TransientMap batches updates to a Map. Nodes it creates are owned by the
+// transient and mutated in place instead of being copied on every change.
+// It must not be used after Persistent is called.
+type TransientMap struct {
+	root  hamtNode
+	count int
+	edit  *editToken
+}
+
+func (t *TransientMap) Evaluate(env *Environment) (Expression, error) {
+	return t, nil
+}
+
+func (t *TransientMap) String() string {
+	return "#<transient-map>"
+}
+
+func (t *TransientMap) Assoc(key, val Expression) error {
+	if t.edit == nil {
+		return fmt.Errorf("transient used after persistent!")
+	}
+	if t.root == nil {
+		t.root = &bitmapNode{edit: t.edit}
+	}
+	added := false
+	t.root = t.root.assoc(t.edit, 0, Hash(key), key, val, &added)
+	if added {
+		t.count++
+	}
+	return nil
+}
+
+func (t *TransientMap) Dissoc(key Expression) error {
+	if t.edit == nil {
+		return fmt.Errorf("transient used after persistent!")
+	}
+	if t.root == nil {
+		return nil
+	}
+	removed := false
+	t.root = t.root.dissoc(t.edit, 0, Hash(key), key, &removed)
+	if removed {
+		t.count--
+	}
+	return nil
+}
+
+// Persistent freezes the transient and returns the resulting map.
+func (t *TransientMap) Persistent() Map {
+	t.edit = nil
+	return Map{root: t.root, count: t.count}
+}
+
+// trie ---
+
+// editToken identifies the transient that owns a node. Nodes with a nil
+// token are shared and never mutated. It is not zero-sized so that every
+// token has a distinct address.
+type editToken struct{ _ byte }
+
+type mapEntry struct {
+	key, val Expression
+	node     hamtNode // non-nil for a child node
+}
+
+type hamtNode interface {
+	find(shift uint, hash uint32, key Expression) (Expression, bool)
+	assoc(edit *editToken, shift uint, hash uint32, key, val Expression, added *bool) hamtNode
+	dissoc(edit *editToken, shift uint, hash uint32, key Expression, removed *bool) hamtNode
+	each(fn func(k, v Expression) bool) bool
+}
+
+type bitmapNode struct {
+	bitmap  uint32
+	entries []mapEntry
+	edit    *editToken
+}
+
+func bitpos(hash uint32, shift uint) uint32 {
+	return 1 << ((hash >> shift) & 31)
+}
+
+func (n *bitmapNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *bitmapNode) editable(edit *editToken) *bitmapNode {
+	if edit != nil && n.edit == edit {
+		return n
+	}
+	entries := make([]mapEntry, len(n.entries), len(n.entries)+1)
+	copy(entries, n.entries)
+	return &bitmapNode{bitmap: n.bitmap, entries: entries, edit: edit}
+}
+
+func (n *bitmapNode) find(shift uint, hash uint32, key Expression) (Expression, bool) {
+	bit := bitpos(hash, shift)
+	if n.bitmap&bit == 0 {
+		return nil, false
+	}
+	e := n.entries[n.index(bit)]
+	if e.node != nil {
+		return e.node.find(shift+5, hash, key)
+	}
+	if Equal(key, e.key) {
+		return e.val, true
+	}
+	return nil, false
+}
+
+func (n *bitmapNode) assoc(edit *editToken, shift uint, hash uint32, key, val Expression, added *bool) hamtNode {
+	bit := bitpos(hash, shift)
+	idx := n.index(bit)
+	if n.bitmap&bit == 0 {
+		*added = true
+		r := n.editable(edit)
+		r.entries = append(r.entries, mapEntry{})
+		copy(r.entries[idx+1:], r.entries[idx:])
+		r.entries[idx] = mapEntry{key: key, val: val}
+		r.bitmap |= bit
+		return r
+	}
+
+	e := n.entries[idx]
+	var replacement mapEntry
+	switch {
+	case e.node != nil:
+		child := e.node.assoc(edit, shift+5, hash, key, val, added)
+		if child == e.node {
+			return n
+		}
+		replacement = mapEntry{node: child}
+	case Equal(key, e.key):
+		replacement = mapEntry{key: e.key, val: val}
+	default:
+		*added = true
+		replacement = mapEntry{node: newPairNode(edit, shift+5, e.key, e.val, hash, key, val)}
+	}
+	r := n.editable(edit)
+	r.entries[idx] = replacement
+	return r
+}
+
+func (n *bitmapNode) dissoc(edit *editToken, shift uint, hash uint32, key Expression, removed *bool) hamtNode {
+	bit := bitpos(hash, shift)
+	if n.bitmap&bit == 0 {
+		return n
+	}
+	idx := n.index(bit)
+	e := n.entries[idx]
+	if e.node != nil {
+		child := e.node.dissoc(edit, shift+5, hash, key, removed)
+		if child == e.node {
+			return n
+		}
+		if child != nil {
+			r := n.editable(edit)
+			r.entries[idx] = mapEntry{node: child}
+			return r
+		}
+	} else if !Equal(key, e.key) {
+		return n
+	}
+	*removed = e.node == nil || *removed
+	if n.bitmap == bit {
+		return nil
+	}
+	r := n.editable(edit)
+	r.entries = append(r.entries[:idx], r.entries[idx+1:]...)
+	r.bitmap &^= bit
+	return r
+}
+
+func (n *bitmapNode) each(fn func(k, v Expression) bool) bool {
+	for _, e := range n.entries {
+		if e.node != nil {
+			if !e.node.each(fn) {
+				return false
+			}
+		} else if !fn(e.key, e.val) {
+			return false
+		}
+	}
+	return true
+}
+
+// newPairNode builds the node holding two entries whose hashes collide up
+// to shift.
+func newPairNode(edit *editToken, shift uint, k1, v1 Expression, h2 uint32, k2, v2 Expression) hamtNode {
+	h1 := Hash(k1)
+	if h1 == h2 {
+		return &collisionNode{hash: h1, entries: []mapEntry{{key: k1, val: v1}, {key: k2, val: v2}}, edit: edit}
+	}
+	added := false
+	var n hamtNode = &bitmapNode{edit: edit}
+	n = n.assoc(edit, shift, h1, k1, v1, &added)
+	return n.assoc(edit, shift, h2, k2, v2, &added)
+}
+
+// collisionNode holds entries whose keys have identical hashes.
+type collisionNode struct {
+	hash    uint32
+	entries []mapEntry
+	edit    *editToken
+}
+
+func (n *collisionNode) editable(edit *editToken) *collisionNode {
+	if edit != nil && n.edit == edit {
+		return n
+	}
+	entries := make([]mapEntry, len(n.entries), len(n.entries)+1)
+	copy(entries, n.entries)
+	return &collisionNode{hash: n.hash, entries: entries, edit: edit}
+}
+
+func (n *collisionNode) indexOf(key Expression) int {
+	for i, e := range n.entries {
+		if Equal(key, e.key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *collisionNode) find(shift uint, hash uint32, key Expression) (Expression, bool) {
+	if i := n.indexOf(key); i >= 0 {
+		return n.entries[i].val, true
+	}
+	return nil, false
+}
+
+func (n *collisionNode) assoc(edit *editToken, shift uint, hash uint32, key, val Expression, added *bool) hamtNode {
+	if hash != n.hash {
+		// Push this node down one level so the new key can sit beside it.
+		parent := &bitmapNode{bitmap: bitpos(n.hash, shift), entries: []mapEntry{{node: n}}, edit: edit}
+		return parent.assoc(edit, shift, hash, key, val, added)
+	}
+	r := n.editable(edit)
+	if i := n.indexOf(key); i >= 0 {
+		r.entries[i].val = val
+		return r
+	}
+	*added = true
+	r.entries = append(r.entries, mapEntry{key: key, val: val})
+	return r
+}
+
+func (n *collisionNode) dissoc(edit *editToken, shift uint, hash uint32, key Expression, removed *bool) hamtNode {
+	i := n.indexOf(key)
+	if i < 0 {
+		return n
+	}
+	*removed = true
+	if len(n.entries) == 1 {
+		return nil
+	}
+	r := n.editable(edit)
+	r.entries = append(r.entries[:i], r.entries[i+1:]...)
+	return r
+}
+
+func (n *collisionNode) each(fn func(k, v Expression) bool) bool {
+	for _, e := range n.entries {
+		if !fn(e.key, e.val) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package yocto
+
+import "testing"
+
+func TestMapAssocDissoc(t *testing.T) {
+	m := Map{}
+	for i := 0; i < 1000; i++ {
+		m = m.Assoc(Number(i), Number(i*i))
+	}
+	if m.Count() != 1000 {
+		t.Fatalf("Expected 1000 entries, got %d", m.Count())
+	}
+	for i := 0; i < 1000; i += 2 {
+		m = m.Dissoc(Number(i))
+	}
+	if m.Count() != 500 {
+		t.Fatalf("Expected 500 entries, got %d", m.Count())
+	}
+	for i := 0; i < 1000; i++ {
+		v, ok := m.Get(Number(i))
+		if ok != (i%2 == 1) {
+			t.Fatalf("Get(%d): unexpected presence %v", i, ok)
+		}
+		if ok && v != Number(i*i) {
+			t.Fatalf("Get(%d) = %v", i, v)
+		}
+	}
+}
+
+func TestTransientDoesNotMutateSource(t *testing.T) {
+	m := Map{}.Assoc(Number(1), Number(1))
+	tm := m.Transient()
+	for i := 0; i < 100; i++ {
+		tm.Assoc(Number(i), String("x"))
+	}
+	built := tm.Persistent()
+	if v, _ := m.Get(Number(1)); v != Number(1) {
+		t.Errorf("Source map was modified: %v", v)
+	}
+	if built.Count() != 100 {
+		t.Errorf("Expected 100 entries, got %d", built.Count())
+	}
+	if err := tm.Assoc(Number(0), Number(0)); err == nil {
+		t.Error("Expected error using transient after persistent")
+	}
+}
+
+func TestMapEqualityIgnoresInsertionOrder(t *testing.T) {
+	a := Map{}.Assoc(Number(1), Number(2)).Assoc(String("k"), List{Number(3)})
+	b := Map{}.Assoc(String("k"), List{Number(3)}).Assoc(Number(1), Number(2))
+	if !Equal(a, b) || Hash(a) != Hash(b) {
+		t.Errorf("Expected %v and %v to be equal with equal hashes", a, b)
+	}
+}
+
+func TestMapHashCollisions(t *testing.T) {
+	// All builtins hash alike, so these keys share a collision node.
+	keys := []*Builtin{{name: "a"}, {name: "b"}, {name: "c"}}
+	m := Map{}.Assoc(Number(1), Number(1))
+	for i, k := range keys {
+		m = m.Assoc(k, Number(i))
+	}
+	m = m.Dissoc(keys[1])
+	if m.Count() != 3 {
+		t.Fatalf("Expected 3 entries, got %d", m.Count())
+	}
+	if v, ok := m.Get(keys[2]); !ok || v != Number(2) {
+		t.Errorf("Get(c) = %v, %v", v, ok)
+	}
+	if _, ok := m.Get(keys[1]); ok {
+		t.Error("Expected b to be removed")
+	}
+}
@@ -0,0 +1,112 @@
+package yocto
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/chzyer/readline"
+)
+
+// ANSI escape sequences used to highlight input.
+const (
+	colorReset   = "\x1b[0m"
+	colorSpecial = "\x1b[35m"  // special forms
+	colorString  = "\x1b[32m"  // strings, characters and regexes
+	colorNumber  = "\x1b[36m"  // numbers
+	colorKeyword = "\x1b[33m"  // keywords
+	colorComment = "\x1b[90m"  // comments
+	colorMatch   = "\x1b[1;4m" // the bracket matching the one before the cursor
+)
+
+// highlightedForms are the special forms with word names; operators such
+// as + are left plain.
+var highlightedForms = make(map[string]bool)
+
+func init() {
+	for _, form := range specialForms {
+		if unicode.IsLetter(rune(form[0])) {
+			highlightedForms[form] = true
+		}
+	}
+}
+
+// colorEnabled reports whether the REPL should highlight input written to
+// w: only when w is a terminal that is not dumb and NO_COLOR is not set.
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && readline.IsTerminal(int(f.Fd()))
+}
+
+// highlighter is a readline Painter that colors the line being typed by
+// token kind and marks the bracket matching a closing bracket just before
+// the cursor.
+type highlighter struct{}
+
+func (highlighter) Paint(line []rune, pos int) []rune {
+	return []rune(highlight(string(line), len(string(line[:pos]))))
+}
+
+// highlight returns src with ANSI colors added. cursor is a byte offset;
+// if it follows a closing bracket, the matching opening bracket is marked.
+// Text the lexer cannot read, such as an unterminated string, is left
+// plain.
+func highlight(src string, cursor int) string {
+	tokens, _ := lex(src)
+	match := -1
+	var open []int
+	for i, t := range tokens {
+		switch t.Kind {
+		case TokenOpen:
+			open = append(open, i)
+		case TokenClose:
+			if len(open) == 0 {
+				continue
+			}
+			if t.Pos+len(t.Text) == cursor {
+				match = open[len(open)-1]
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	var sb strings.Builder
+	last := 0
+	for i, t := range tokens {
+		sb.WriteString(src[last:t.Pos])
+		last = t.Pos + len(t.Text)
+		color := tokenColor(t)
+		if i == match {
+			color = colorMatch
+		}
+		if color == "" {
+			sb.WriteString(t.Text)
+			continue
+		}
+		sb.WriteString(color + t.Text + colorReset)
+	}
+	sb.WriteString(src[last:])
+	return sb.String()
+}
+
+func tokenColor(t Token) string {
+	switch t.Kind {
+	case TokenString, TokenChar, TokenRegex:
+		return colorString
+	case TokenNumber:
+		return colorNumber
+	case TokenKeyword:
+		return colorKeyword
+	case TokenComment, TokenDatumComment:
+		return colorComment
+	case TokenSymbol:
+		if highlightedForms[t.Text] {
+			return colorSpecial
+		}
+	}
+	return ""
+}
@@ -0,0 +1,295 @@
+package yocto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+type Expression interface {
+	Evaluate(env *Environment) (Expression, error)
+}
+
+func EvalString(input string) (string, error) {
+	return EvalStringContext(context.Background(), input)
+}
+
+// EvalStringContext is like EvalString but stops with ErrInterrupted when
+// ctx is done.
+func EvalStringContext(ctx context.Context, input string) (string, error) {
+	env := NewEnvironment(nil)
+	env.SetContext(ctx)
+	return evalString(input, env)
+}
+
+// evalString evaluates every form in input in env and returns the readable
+// form of the last result.
+func evalString(input string, env *Environment) (string, error) {
+	var result Expression
+	err := evalForms(input, env, func(value Expression) {
+		result = value
+	})
+	if err != nil {
+		return "", err
+	}
+	return Write(result), nil
+}
+
+// evalForms evaluates every form in code, calling fn with each result.
+func evalForms(code string, env *Environment, fn func(Expression)) error {
+	tokens, err := tokenize(code)
+	if err != nil {
+		return err
+	}
+	for len(tokens) > 0 {
+		var expr Expression
+		expr, tokens, err = parseExpr(tokens)
+		if err != nil {
+			return err
+		}
+		result, err := evaluate(expr, env)
+		if err != nil {
+			return err
+		}
+		fn(result)
+	}
+	return nil
+}
+
+// Interpreter evaluates yocto code for a Go program. Definitions made by
+// one call to Eval are visible to the next. An Interpreter must not be
+// used by more than one goroutine at a time.
+type Interpreter struct {
+	env *Environment
+}
+
+// NewInterpreter returns an interpreter with every builtin bound.
+func NewInterpreter() *Interpreter {
+	return &Interpreter{env: NewEnvironment(nil)}
+}
+
+// NewSandboxInterpreter returns an interpreter with only the builtins in
+// the named groups bound; see NewSandbox.
+func NewSandboxInterpreter(groups ...string) (*Interpreter, error) {
+	env, err := NewSandbox(groups...)
+	if err != nil {
+		return nil, err
+	}
+	return &Interpreter{env: env}, nil
+}
+
+// SetLimits applies limits to each later call to Eval, EvalFile or Call.
+func (in *Interpreter) SetLimits(limits Limits) {
+	in.env.state.limits = limits
+}
+
+// SetOutput sends what evaluated code prints to w instead of os.Stdout.
+func (in *Interpreter) SetOutput(w io.Writer) {
+	in.env.SetOutput(w)
+}
+
+// Eval evaluates every form in src and returns the value of the last.
+func (in *Interpreter) Eval(ctx context.Context, src string) (Expression, error) {
+	in.begin(ctx)
+	defer in.env.SetContext(nil)
+	var result Expression
+	err := evalForms(src, in.env, func(value Expression) {
+		result = value
+	})
+	return result, err
+}
+
+// EvalFile evaluates the file at path.
+func (in *Interpreter) EvalFile(ctx context.Context, path string) (Expression, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := in.Eval(ctx, string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return result, nil
+}
+
+// Define binds name to value, converted with ToExpression.
+func (in *Interpreter) Define(name string, value interface{}) error {
+	expr, err := ToExpression(value)
+	if err != nil {
+		return err
+	}
+	in.env.Set(Intern(name), expr)
+	return nil
+}
+
+// Lookup returns the value bound to name.
+func (in *Interpreter) Lookup(name string) (Expression, bool) {
+	return in.env.Get(Intern(name))
+}
+
+// Call calls the function bound to name with args, converted with
+// ToExpression. Cancelling ctx interrupts the call.
+func (in *Interpreter) Call(ctx context.Context, name string, args ...interface{}) (Expression, error) {
+	fn, ok := in.env.Get(Intern(name))
+	if !ok {
+		return nil, fmt.Errorf("undefined name: %s", name)
+	}
+	exprs := make([]Expression, len(args))
+	for i, arg := range args {
+		expr, err := ToExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = expr
+	}
+	in.begin(ctx)
+	defer in.env.SetContext(nil)
+	return apply(fn, exprs, in.env)
+}
+
+// begin starts an evaluation: it sets its context and restarts the step
+// count and timeout.
+func (in *Interpreter) begin(ctx context.Context) {
+	in.env.SetLimits(in.env.state.limits)
+	in.env.SetContext(ctx)
+}
+
+// ToExpression converts a Go value to an Expression. Booleans, numbers and
+// strings become the matching yocto values, byte slices strings, other
+// slices and arrays vectors, maps maps and structs records of the type
+// recordFor makes. Expressions are returned unchanged.
+func ToExpression(value interface{}) (Expression, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case Expression:
+		return v, nil
+	case bool:
+		return Boolean(v), nil
+	case string:
+		return String(v), nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Number(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Number(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return Number(rv.Float()), nil
+	case reflect.String:
+		return String(rv.String()), nil
+	case reflect.Bool:
+		return Boolean(rv.Bool()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return String(rv.Bytes()), nil
+		}
+		items := make([]Expression, rv.Len())
+		for i := range items {
+			item, err := ToExpression(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return NewVector(items...), nil
+	case reflect.Map:
+		t := Map{}.Transient()
+		iter := rv.MapRange()
+		for iter.Next() {
+			k, err := ToExpression(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			v, err := ToExpression(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			t.Assoc(k, v)
+		}
+		return t.Persistent(), nil
+	case reflect.Struct:
+		sr := recordFor(rv.Type())
+		values := make([]Expression, len(sr.fields))
+		for i, index := range sr.fields {
+			value, err := ToExpression(rv.Field(index).Interface())
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return &Record{typ: sr.typ, values: values}, nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return ToExpression(rv.Elem().Interface())
+	}
+	return nil, fmt.Errorf("cannot convert %T to a yocto value", value)
+}
+
+// FromExpression converts an Expression to a plain Go value: nil, bool,
+// float64, string or rune, []interface{} for lists, vectors and sets, and
+// map[interface{}]interface{} for maps, with collection keys written as
+// strings. Symbols and keywords become their
+// names, and records maps from field name to value. Other values, such as
+// functions, are returned unchanged.
+func FromExpression(expr Expression) interface{} {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case Boolean:
+		return bool(e)
+	case Number:
+		return float64(e)
+	case String:
+		return string(e)
+	case Char:
+		return rune(e)
+	case Name:
+		return e.String()
+	case *Keyword:
+		return e.name
+	case List:
+		return fromItems(e)
+	case Vector:
+		return fromItems(e.Items())
+	case Set:
+		var items []Expression
+		e.Each(func(item Expression) bool {
+			items = append(items, item)
+			return true
+		})
+		return fromItems(items)
+	case Map:
+		result := make(map[interface{}]interface{}, e.Count())
+		e.Each(func(k, v Expression) bool {
+			key := FromExpression(k)
+			switch key.(type) {
+			case []interface{}, map[interface{}]interface{}:
+				key = Write(k) // not comparable, so not a valid Go map key
+			}
+			result[key] = FromExpression(v)
+			return true
+		})
+		return result
+	case *Record:
+		result := make(map[interface{}]interface{}, len(e.values))
+		for i, value := range e.values {
+			result[e.typ.fields[i].name] = FromExpression(value)
+		}
+		return result
+	}
+	return expr
+}
+
+func fromItems(items []Expression) []interface{} {
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		result[i] = FromExpression(item)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package yocto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInterpreter(t *testing.T) {
+	in := NewInterpreter()
+	var out bytes.Buffer
+	in.SetOutput(&out)
+	ctx := context.Background()
+
+	if _, err := in.Eval(ctx, "(defn (square x) (* x x))"); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Define("limit", 3); err != nil {
+		t.Fatal(err)
+	}
+	result, err := in.Eval(ctx, "(print (square limit)) (square limit)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != Number(9) || out.String() != "9\n" {
+		t.Errorf("got %s printing %q, want 9 printing \"9\\n\"", Write(result), out.String())
+	}
+
+	result, err = in.Call(ctx, "square", 4)
+	if err != nil || result != Number(16) {
+		t.Errorf("Call(square, 4) = %v, %v, want 16", result, err)
+	}
+	if _, err := in.Call(ctx, "cube", 4); err == nil {
+		t.Error("Call(cube) succeeded, want an undefined name error")
+	}
+	if _, ok := in.Lookup("square"); !ok {
+		t.Error("Lookup(square) found nothing")
+	}
+
+	path := filepath.Join(t.TempDir(), "lib.yoc")
+	if err := os.WriteFile(path, []byte("(def greeting \"hi\")\n(/ 1 0)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.EvalFile(ctx, path); err == nil {
+		t.Error("EvalFile succeeded, want a division error")
+	}
+	if greeting, _ := in.Lookup("greeting"); greeting != String("hi") {
+		t.Errorf("greeting = %v, want \"hi\"", greeting)
+	}
+}
+
+func TestInterpreterLimits(t *testing.T) {
+	in := NewInterpreter()
+	in.SetLimits(Limits{MaxSteps: 1000})
+	ctx := context.Background()
+	if _, err := in.Eval(ctx, "(defn (loop n) (loop (+ n 1)))"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := in.Call(ctx, "loop", 0); err == nil {
+			t.Fatal("Call(loop) succeeded, want a step limit error")
+		}
+	}
+	// Each evaluation gets its own step count.
+	if _, err := in.Eval(ctx, "(+ 1 2)"); err != nil {
+		t.Errorf("Eval after a limit error: %v", err)
+	}
+
+	in.SetLimits(Limits{})
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := in.Call(cancelled, "loop", 0); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Call with a cancelled context = %v, want ErrInterrupted", err)
+	}
+}
+
+func TestConversion(t *testing.T) {
+	expr, err := ToExpression(map[string][]int{"a": {1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Write(expr); got != `{"a" [1 2]}` {
+		t.Errorf("ToExpression = %s", got)
+	}
+	if _, err := ToExpression(make(chan int)); err == nil {
+		t.Error("ToExpression(chan) succeeded")
+	}
+
+	in := NewInterpreter()
+	result, err := in.Eval(context.Background(), `{:name "x" :tags '(a b) [1] #{true}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[interface{}]interface{}{
+		"name": "x",
+		"tags": []interface{}{"a", "b"},
+		"[1]":  []interface{}{true},
+	}
+	if got := FromExpression(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("FromExpression = %#v, want %#v", got, want)
+	}
+}
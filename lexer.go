@@ -0,0 +1,414 @@
+package yocto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenKind int
+
+const (
+	TokenOpen         TokenKind = iota // ( [ { #{
+	TokenClose                         // ) ] }
+	TokenQuote                         // ' ` , ,@
+	TokenString                        // "...", #"..." and """..."""
+	TokenNumber                        // 42, -1.5
+	TokenChar                          // #\a
+	TokenRegex                         // #/pattern/
+	TokenKeyword                       // :name and :|name|
+	TokenSymbol                        // |name| and any other atom
+	TokenComment                       // ; line and #| block |# comments
+	TokenDatumComment                  // #_, which comments out the next form
+)
+
+// Token is a lexeme with its position in the source. Text is the source
+// text; for strings Value holds the decoded contents, and for |name|
+// symbols and keywords the name.
+type Token struct {
+	Kind  TokenKind
+	Text  string
+	Value string
+	Pos   int // byte offset
+	Line  int // 1-based
+	Col   int // 1-based, in runes
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%d:%d %q", t.Line, t.Col, t.Text)
+}
+
+// SyntaxError is a lexing or parsing error at a source position.
+type SyntaxError struct {
+	Line, Col int
+	Msg       string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+type lexer struct {
+	src       string
+	pos       int
+	line, col int
+	tokens    []Token
+}
+
+// tokenize splits input into the tokens the parser reads, with comments
+// and the forms commented out by #_ removed.
+func tokenize(input string) ([]Token, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	return stripComments(tokens)
+}
+
+// lex splits input into tokens, keeping comments.
+func lex(input string) ([]Token, error) {
+	l := &lexer{src: input, line: 1, col: 1}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.src) {
+			return l.tokens, nil
+		}
+		if err := l.next(); err != nil {
+			return l.tokens, err
+		}
+	}
+}
+
+func stripComments(tokens []Token) ([]Token, error) {
+	result := make([]Token, 0, len(tokens))
+	for i := 0; i < len(tokens); {
+		switch tokens[i].Kind {
+		case TokenComment:
+			i++
+		case TokenDatumComment:
+			next, err := skipDatum(tokens, i+1, tokens[i])
+			if err != nil {
+				return nil, err
+			}
+			i = next
+		default:
+			result = append(result, tokens[i])
+			i++
+		}
+	}
+	return result, nil
+}
+
+// skipDatum returns the index just past the form starting at tokens[i],
+// skipping comments before it. Like the reader, it treats #_ and the form
+// it comments out as if they were not there, so #_ #_ a b skips a and b.
+// marker is the #_ being skipped for, where a missing form is reported.
+func skipDatum(tokens []Token, i int, marker Token) (int, error) {
+	for i < len(tokens) && tokens[i].Kind == TokenComment {
+		i++
+	}
+	if i >= len(tokens) {
+		return i, syntaxError(marker, "unexpected EOF after #_")
+	}
+	switch t := tokens[i]; t.Kind {
+	case TokenDatumComment:
+		next, err := skipDatum(tokens, i+1, t)
+		if err != nil {
+			return next, err
+		}
+		return skipDatum(tokens, next, marker)
+	case TokenQuote:
+		return skipDatum(tokens, i+1, marker)
+	case TokenClose:
+		return i, syntaxError(t, "#_ must be followed by a form")
+	case TokenOpen:
+		depth := 0
+		for ; i < len(tokens); i++ {
+			switch tokens[i].Kind {
+			case TokenOpen:
+				depth++
+			case TokenClose:
+				if depth--; depth == 0 {
+					return i + 1, nil
+				}
+			}
+		}
+		return i, syntaxError(t, "missing closing "+closingNames[closerFor(t.Text)])
+	}
+	return i + 1, nil
+}
+
+// closerFor returns the closing token for an opening token.
+func closerFor(open string) string {
+	switch open {
+	case "(":
+		return ")"
+	case "[":
+		return "]"
+	}
+	return "}"
+}
+
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("()[]{}\"'`,;&", r)
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset >= len(l.src) {
+		return utf8.RuneError
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos+offset:])
+	return r
+}
+
+func (l *lexer) advance(n int) {
+	for _, r := range l.src[l.pos : l.pos+n] {
+		if r == '\n' {
+			l.line, l.col = l.line+1, 1
+		} else {
+			l.col++
+		}
+	}
+	l.pos += n
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		l.advance(size)
+	}
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: l.line, Col: l.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// emit appends a token covering the next n bytes.
+func (l *lexer) emit(kind TokenKind, n int, value string) {
+	l.tokens = append(l.tokens, Token{Kind: kind, Text: l.src[l.pos : l.pos+n], Value: value, Pos: l.pos, Line: l.line, Col: l.col})
+	l.advance(n)
+}
+
+func (l *lexer) next() error {
+	rest := l.src[l.pos:]
+	switch {
+	case rest[0] == ';':
+		n := strings.IndexByte(rest, '\n')
+		if n < 0 {
+			n = len(rest)
+		}
+		l.emit(TokenComment, n, "")
+	case strings.HasPrefix(rest, "#|"):
+		return l.blockComment()
+	case strings.HasPrefix(rest, "#_"):
+		l.emit(TokenDatumComment, 2, "")
+	case strings.HasPrefix(rest, "#{"):
+		l.emit(TokenOpen, 2, "")
+	case strings.ContainsRune("([{", rune(rest[0])):
+		l.emit(TokenOpen, 1, "")
+	case strings.ContainsRune(")]}", rune(rest[0])):
+		l.emit(TokenClose, 1, "")
+	case strings.HasPrefix(rest, ",@"):
+		l.emit(TokenQuote, 2, "")
+	case strings.ContainsRune("'`,", rune(rest[0])):
+		l.emit(TokenQuote, 1, "")
+	case rest[0] == '&':
+		l.emit(TokenSymbol, 1, "")
+	case rest[0] == '|' || strings.HasPrefix(rest, ":|"):
+		return l.barName()
+	case strings.HasPrefix(rest, `"""`):
+		return l.rawString(3, `"""`)
+	case strings.HasPrefix(rest, `#"`):
+		return l.rawString(2, `"`)
+	case rest[0] == '"':
+		return l.string()
+	case strings.HasPrefix(rest, "#/"):
+		return l.regex()
+	case strings.HasPrefix(rest, `#\`) && len(rest) > 2:
+		// The first character after #\ is always part of the literal, so
+		// #\( and #\space both work.
+		_, size := utf8.DecodeRuneInString(rest[2:])
+		n := 2 + size + l.atomLength(2+size)
+		l.emit(TokenChar, n, "")
+	default:
+		n := l.atomLength(0)
+		if n == 0 {
+			return l.errorf("unexpected character %q", l.peek(0))
+		}
+		text := rest[:n]
+		kind := TokenSymbol
+		if isNumber(text) {
+			kind = TokenNumber
+		} else if len(text) > 1 && text[0] == ':' {
+			kind = TokenKeyword
+		} else if text[0] == '#' && strings.HasPrefix(rest[n:], "{") {
+			// #point{...} opens a record literal.
+			kind = TokenOpen
+			n++
+		}
+		l.emit(kind, n, "")
+	}
+	return nil
+}
+
+// isNumber reports whether an atom is a decimal number. Unlike
+// strconv.ParseFloat alone it rejects words such as inf and nan, which are
+// symbols; infinities and NaN are written ##Inf, ##-Inf and ##NaN.
+func isNumber(text string) bool {
+	switch text {
+	case "##Inf", "##-Inf", "##NaN":
+		return true
+	}
+	digits := strings.TrimLeft(text, "+-")
+	digits = strings.TrimPrefix(digits, ".")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' || strings.ContainsAny(text, "xXpP_") {
+		return false
+	}
+	_, err := strconv.ParseFloat(text, 64)
+	return err == nil
+}
+
+// atomLength returns the length in bytes of the atom starting at offset.
+func (l *lexer) atomLength(offset int) int {
+	n := offset
+	for l.pos+n < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos+n:])
+		if isDelimiter(r) {
+			break
+		}
+		n += size
+	}
+	return n - offset
+}
+
+// rawString reads a string with no escape processing, such as #"C:\dir"
+// or a triple-quoted string. Contents, including newlines, are kept as is.
+func (l *lexer) rawString(open int, closing string) error {
+	end := strings.Index(l.src[l.pos+open:], closing)
+	if end < 0 {
+		return l.errorf("unterminated string")
+	}
+	n := open + end + len(closing)
+	l.emit(TokenString, n, l.src[l.pos+open:l.pos+open+end])
+	return nil
+}
+
+// string reads a double-quoted string with Go escape sequences plus
+// \u{...} for code points of any length.
+func (l *lexer) string() error {
+	var sb strings.Builder
+	i := l.pos + 1
+	for i < len(l.src) {
+		switch c := l.src[i]; c {
+		case '"':
+			l.emit(TokenString, i+1-l.pos, sb.String())
+			return nil
+		case '\\':
+			if strings.HasPrefix(l.src[i:], `\u{`) {
+				end := strings.IndexByte(l.src[i:], '}')
+				if end < 0 {
+					return l.errorf("unterminated \\u{ escape")
+				}
+				code, err := strconv.ParseUint(l.src[i+3:i+end], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return l.errorf("invalid unicode escape %s", l.src[i:i+end+1])
+				}
+				sb.WriteRune(rune(code))
+				i += end + 1
+				continue
+			}
+			value, multibyte, tail, err := strconv.UnquoteChar(l.src[i:], '"')
+			if err != nil {
+				return l.errorf("invalid escape sequence in string")
+			}
+			if multibyte {
+				sb.WriteRune(value)
+			} else {
+				sb.WriteByte(byte(value))
+			}
+			i = len(l.src) - len(tail)
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return l.errorf("unterminated string")
+}
+
+// regex reads #/pattern/. Inside the pattern \/ stands for a slash; every
+// other backslash is passed to the regexp engine unchanged.
+func (l *lexer) regex() error {
+	var sb strings.Builder
+	for i := l.pos + 2; i < len(l.src); i++ {
+		switch {
+		case strings.HasPrefix(l.src[i:], `\/`):
+			sb.WriteByte('/')
+			i++
+		case l.src[i] == '\\' && i+1 < len(l.src):
+			sb.WriteString(l.src[i : i+2])
+			i++
+		case l.src[i] == '/':
+			l.emit(TokenRegex, i+1-l.pos, sb.String())
+			return nil
+		default:
+			sb.WriteByte(l.src[i])
+		}
+	}
+	return l.errorf("unterminated regular expression")
+}
+
+// barName reads |name| or :|name|, a symbol or keyword whose name can
+// hold any characters, such as spaces or the text of a number. Inside the
+// bars \| stands for a bar and \\ for a backslash.
+func (l *lexer) barName() error {
+	kind, start := TokenSymbol, l.pos+1
+	if l.src[l.pos] == ':' {
+		kind, start = TokenKeyword, l.pos+2
+	}
+	var sb strings.Builder
+	for i := start; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '\\':
+			if i+1 == len(l.src) || (l.src[i+1] != '|' && l.src[i+1] != '\\') {
+				return l.errorf("invalid escape sequence in |name|")
+			}
+			i++
+			sb.WriteByte(l.src[i])
+		case '|':
+			if sb.Len() == 0 {
+				return l.errorf("empty name between bars")
+			}
+			l.emit(kind, i+1-l.pos, sb.String())
+			return nil
+		default:
+			sb.WriteByte(l.src[i])
+		}
+	}
+	return l.errorf("unterminated |name|")
+}
+
+// blockComment reads #| ... |#. Block comments nest, so a region that
+// already contains one can be commented out.
+func (l *lexer) blockComment() error {
+	depth := 0
+	for i := l.pos; i < len(l.src); i++ {
+		switch {
+		case strings.HasPrefix(l.src[i:], "#|"):
+			depth++
+			i++
+		case strings.HasPrefix(l.src[i:], "|#"):
+			depth--
+			i++
+			if depth == 0 {
+				l.emit(TokenComment, i+1-l.pos, "")
+				return nil
+			}
+		}
+	}
+	return l.errorf("unterminated block comment")
+}
@@ -0,0 +1,161 @@
+package yocto
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Limits bounds the resources an evaluation may use, for running code that
+// is not trusted. A zero field means no limit.
+type Limits struct {
+	MaxSteps int           // forms evaluated
+	MaxDepth int           // nested function calls
+	MaxAlloc int           // length of a string, list or collection a builtin returns, and of the names builtins intern
+	Timeout  time.Duration // wall-clock time
+}
+
+// StepLimitError is returned when an evaluation takes more than MaxSteps
+// steps.
+type StepLimitError struct {
+	Limit int
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+}
+
+// DepthLimitError is returned when calls nest deeper than MaxDepth.
+type DepthLimitError struct {
+	Limit int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("call depth limit of %d exceeded", e.Limit)
+}
+
+// AllocLimitError is returned when a builtin would produce a value longer
+// than MaxAlloc, or intern more than MaxAlloc bytes of names.
+type AllocLimitError struct {
+	Limit, Size int
+}
+
+func (e *AllocLimitError) Error() string {
+	return fmt.Sprintf("allocation of %d exceeds limit of %d", e.Size, e.Limit)
+}
+
+// TimeoutError is returned when an evaluation runs longer than Timeout.
+type TimeoutError struct {
+	Limit time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout of %v exceeded", e.Limit)
+}
+
+// SetLimits applies limits to evaluation in env and in environments
+// created inside it, starting the step count and timeout afresh.
+func (env *Environment) SetLimits(limits Limits) {
+	s := env.state
+	s.limits, s.steps, s.depth, s.interned = limits, 0, 0, 0
+	s.deadline = time.Time{}
+	if limits.Timeout > 0 {
+		s.deadline = time.Now().Add(limits.Timeout)
+	}
+}
+
+// enter is called on entering a function call and returns a
+// DepthLimitError if that nests calls too deeply. Each successful enter
+// must be matched by a call to leave.
+func (env *Environment) enter() error {
+	s := env.state
+	if s.limits.MaxDepth > 0 && s.depth >= s.limits.MaxDepth {
+		return &DepthLimitError{Limit: s.limits.MaxDepth}
+	}
+	s.depth++
+	return nil
+}
+
+func (env *Environment) leave() {
+	env.state.depth--
+}
+
+// checkAlloc returns an AllocLimitError if value is longer than MaxAlloc.
+func (env *Environment) checkAlloc(value Expression) error {
+	limit := env.state.limits.MaxAlloc
+	if limit <= 0 {
+		return nil
+	}
+	var size int
+	switch v := value.(type) {
+	case String:
+		size = len(v)
+	case List:
+		size = len(v)
+	case Vector:
+		size = v.Count()
+	case Map:
+		size = v.Count()
+	case Set:
+		size = v.Count()
+	}
+	return env.checkSize(size)
+}
+
+// checkSize returns an AllocLimitError if size is more than MaxAlloc.
+// Builtins that build a string piece by piece call it before growing it.
+func (env *Environment) checkSize(size int) error {
+	if limit := env.state.limits.MaxAlloc; limit > 0 && size > limit {
+		return &AllocLimitError{Limit: limit, Size: size}
+	}
+	return nil
+}
+
+// appendString appends s to sb, unless that would make it longer than
+// MaxAlloc.
+func (env *Environment) appendString(sb *strings.Builder, s string) error {
+	if err := env.checkSize(sb.Len() + len(s)); err != nil {
+		return err
+	}
+	sb.WriteString(s)
+	return nil
+}
+
+// countInterned adds n bytes of new names to those interned by builtins
+// in the evaluation. Interned names are never freed, so MaxAlloc bounds
+// their total; otherwise code in a loop could grow the tables forever.
+func (env *Environment) countInterned(n int) error {
+	env.state.interned += n
+	return env.checkSize(env.state.interned)
+}
+
+// checkIntern counts name, as a keyword if keyword is set, if it is not
+// interned yet.
+func (env *Environment) checkIntern(name string, keyword bool) error {
+	if keyword && keywordInterned(name) || !keyword && symbolInterned(name) {
+		return nil
+	}
+	return env.countInterned(len(name))
+}
+
+// checkTokenNames applies checkIntern to the symbols and keywords in
+// tokens, before parsing interns them.
+func (env *Environment) checkTokenNames(tokens []Token) error {
+	for _, token := range tokens {
+		if token.Kind == TokenSymbol || token.Kind == TokenKeyword {
+			if err := env.checkIntern(tokenName(token), token.Kind == TokenKeyword); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EvalStringLimits is like EvalStringContext but also enforces limits.
+func EvalStringLimits(ctx context.Context, input string, limits Limits) (string, error) {
+	env := NewEnvironment(nil)
+	env.SetContext(ctx)
+	env.SetLimits(limits)
+	return evalString(input, env)
+}
@@ -1,7 +1,12 @@
-package main
+package yocto
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestYoctoLisp(t *testing.T) {
@@ -25,6 +30,361 @@ func TestYoctoLisp(t *testing.T) {
 			input:    "(defmacro (add a b) `(+ ,a ,b)) (add 1 1)",
 			expected: "2",
 		},
+		{
+			name:     "Map literal and get",
+			input:    "(def m {1 2 3 (+ 2 2)}) (get m 3)",
+			expected: "4",
+		},
+		{
+			name:     "Assoc leaves the original map unchanged",
+			input:    "(def m {1 2}) (assoc m 1 5) (get m 1)",
+			expected: "2",
+		},
+		{
+			name:     "Map keys use structural equality",
+			input:    "(get {'(1 2) 3} '(1 2))",
+			expected: "3",
+		},
+		{
+			name:     "Nested maps",
+			input:    "(get-in (assoc-in {} '(1 2) 3) '(1 2))",
+			expected: "3",
+		},
+		{
+			name:     "Get-in finds a nil value",
+			input:    "(get-in {:a {:b nil}} [:a :b] 5)",
+			expected: "nil",
+		},
+		{
+			name:     "Get-in defaults for a missing key",
+			input:    "(get-in {:a {:b nil}} [:a :c] 5)",
+			expected: "5",
+		},
+		{
+			name:     "Update applies a function",
+			input:    "(get (update {1 2} 1 (func (f x) (* x 10))) 1)",
+			expected: "20",
+		},
+		{
+			name:     "Vector literal prints back",
+			input:    "(conj [1 2 (+ 1 2)] 4)",
+			expected: "[1 2 3 4]",
+		},
+		{
+			name:     "Vector nth and assoc",
+			input:    "(nth (assoc [1 2 3] 1 5) 1)",
+			expected: "5",
+		},
+		{
+			name:     "Set operations",
+			input:    "(= (intersection #{1 2 3} #{2 3 4}) #{3 2})",
+			expected: "true",
+		},
+		{
+			name:     "Subset",
+			input:    "(subset? (difference #{1 2 3} #{1}) #{2 3})",
+			expected: "true",
+		},
+		{
+			name:     "Lists print as S-expressions",
+			input:    "'(1 (2 3))",
+			expected: "(1 (2 3))",
+		},
+		{
+			name:     "Keywords evaluate to themselves",
+			input:    ":name",
+			expected: ":name",
+		},
+		{
+			name:     "Keywords look themselves up in maps",
+			input:    "(def person {:name 1 :age 2}) (:age person)",
+			expected: "2",
+		},
+		{
+			name:     "Keyword lookup with default",
+			input:    "(:missing {:a 1} 7)",
+			expected: "7",
+		},
+		{
+			name:     "Keywords are interned",
+			input:    "(= (keyword (quote id)) :id)",
+			expected: "true",
+		},
+		{
+			name:     "Symbols compare by identity",
+			input:    "(= (string->symbol (symbol->string 'abc)) 'abc)",
+			expected: "true",
+		},
+		{
+			name:     "Namespaced symbols",
+			input:    "(namespace (symbol 'geo 'point))",
+			expected: `"geo"`,
+		},
+		{
+			name:     "Local part of a namespaced symbol",
+			input:    "(name 'geo/point)",
+			expected: `"point"`,
+		},
+		{
+			name:     "Symbol predicate",
+			input:    "(and (symbol? (symbol 'x)) (not (symbol? :x)))",
+			expected: "true",
+		},
+		{
+			name:     "Gensyms differ from symbols with the same text",
+			input:    "(def g (gensym \"x\")) (vector (= g g) (= g (string->symbol (symbol->string g))))",
+			expected: "[true false]",
+		},
+		{
+			name:     "Record constructor prints readably",
+			input:    "(defrecord point x y) (point 1 2)",
+			expected: "#point{:x 1 :y 2}",
+		},
+		{
+			name:     "Record accessors and keyword lookup",
+			input:    "(defrecord point x y) (def p (point 1 2)) (+ (point-x p) (:y p))",
+			expected: "3",
+		},
+		{
+			name:     "Record updater is functional",
+			input:    "(defrecord point x y) (def p (point 1 2)) (point-with p :x 5) (point-x p)",
+			expected: "1",
+		},
+		{
+			name:     "Records compare structurally",
+			input:    "(defrecord point x y) (and (point? (point 1 2)) (= (point-with (point 0 2) :x 1) (point 1 2)))",
+			expected: "true",
+		},
+		{
+			name:     "Protocol dispatch on records",
+			input:    "(defrecord rect w h) (defprotocol shape (area s)) (extend-type rect shape ((area r) (* (rect-w r) (rect-h r)))) (area (rect 2 3))",
+			expected: "6",
+		},
+		{
+			name:     "Protocols extend built-in types",
+			input:    "(defprotocol sized (size x)) (extend-type Number sized ((size n) n)) (extend-type List sized ((size l) (count l))) (+ (size 4) (size '(1 2)))",
+			expected: "6",
+		},
+		{
+			name:     "Records named like built-in types dispatch separately",
+			input:    "(defrecord Number v) (defprotocol sized (size x)) (extend-type Number sized ((size n) 1)) (vector (size (Number 5)) (satisfies? sized 5))",
+			expected: "[1 false]",
+		},
+		{
+			name:     "Multimethod dispatch with default",
+			input:    "(defmulti kind (func (f x) (:k x))) (defmethod kind :a (x) 1) (defmethod kind :default (x) 0) (+ (kind {:k :a}) (kind {:k :z}))",
+			expected: "1",
+		},
+		{
+			name:     "Multimethod dispatch through derive",
+			input:    "(derive :test/square :test/rect) (defmulti corners (func (f x) x)) (defmethod corners :test/rect (x) 4) (corners :test/square)",
+			expected: "4",
+		},
+		{
+			name:     "Variants print as literals",
+			input:    "(deftype shape (circle r) (rect w h)) (rect 2 3)",
+			expected: "#rect{:w 2 :h 3}",
+		},
+		{
+			name:     "Match destructures variants",
+			input:    "(deftype shape (circle r) (rect w h)) (match (rect 2 3) ((circle r) r) ((rect w h) (* w h)))",
+			expected: "6",
+		},
+		{
+			name:     "Variants are introspectable",
+			input:    "(deftype opt (some x) none) (variants-of opt)",
+			expected: "((some x) none)",
+		},
+		{
+			name:     "Character literals",
+			input:    "(str #\\h #\\u00e9 #\\space 'x)",
+			expected: `"hé x"`,
+		},
+		{
+			name:     "String length counts runes",
+			input:    `(string-length "é日a")`,
+			expected: "3",
+		},
+		{
+			name:     "Upper and substring",
+			input:    `(upper (substring "héllo" 1 3))`,
+			expected: `"ÉL"`,
+		},
+		{
+			name:     "Split and join",
+			input:    `(join "-" (split "a.b.c" "."))`,
+			expected: `"a-b-c"`,
+		},
+		{
+			name:     "Split on an empty separator gives characters",
+			input:    `(split "héy" "")`,
+			expected: `("h" "é" "y")`,
+		},
+		{
+			name:     "Number radix conversion",
+			input:    "(string->number (number->string 255 16) 16)",
+			expected: "255",
+		},
+		{
+			name:     "string->number reads numbers as read does",
+			input:    `[(string->number " 1e3 ") (string->number "##-Inf") (string->number "Inf") (string->number "NaN") (string->number "infinity")]`,
+			expected: "[1000 ##-Inf nil nil nil]",
+		},
+		{
+			name:     "String literals keep whitespace",
+			input:    "\"a  b\n\tc\"",
+			expected: `"a  b\n\tc"`,
+		},
+		{
+			name:     "String escapes",
+			input:    `(str "q\"uote" "\u00e9" "\u{1F600}" "\x41")`,
+			expected: `"q\"uoteé😀A"`,
+		},
+		{
+			name:     "Raw strings",
+			input:    `(str #"C:\new\dir" """say "hi"\n""")`,
+			expected: `"C:\\new\\dirsay \"hi\"\\n"`,
+		},
+		{
+			name:     "Multi-line strings preserve layout",
+			input:    "(string-length \"one\n  two\")",
+			expected: "9",
+		},
+		{
+			name:     "Format directives",
+			input:    `(format "~a has ~d items~%" "bob" 3)`,
+			expected: `"bob has 3 items\n"`,
+		},
+		{
+			name:     "Format width, precision and padding",
+			input:    `(format "[~5d|~5,'0d|~8,2f|~4a]" 42 -7 3.14159 "ab")`,
+			expected: `"[   42|-0007|    3.14|ab  ]"`,
+		},
+		{
+			name:     "Fmt interpolates expressions in scope",
+			input:    `(def name "bob") (def n 3) (fmt "{name} has {(+ n 1)} items")`,
+			expected: `"bob has 4 items"`,
+		},
+		{
+			name:     "Fmt format specs",
+			input:    `(def x 4.5) (fmt "{x:08.2f}|{\"ab\":>4}|{255:x}|{{}}")`,
+			expected: `"00004.50|  ab|ff|{}"`,
+		},
+		{
+			name:     "Fmt centres with ^",
+			input:    `(fmt "[{\"ab\":^5}][{7:*^4}][{\"é\":·^3}]")`,
+			expected: `"[ ab  ][*7**][·é·]"`,
+		},
+		{
+			name:     "Regex literal prints back",
+			input:    `#/a\/b\d+/`,
+			expected: `#/a\/b\d+/`,
+		},
+		{
+			name:     "Escaped slashes in re-pattern print back",
+			input:    `(def re (re-pattern "a\\/b/c")) (vector re (= (read-string (repr re)) re))`,
+			expected: `[#/a\/b\/c/ true]`,
+		},
+		{
+			name:     "Regex groups",
+			input:    `(re-match #/(\d+)-(\d+)/ "x 12-34")`,
+			expected: `["12-34" "12" "34"]`,
+		},
+		{
+			name:     "Named groups become maps",
+			input:    `(:year (re-match #/(?P<year>\d{4})-(?P<month>\d\d)/ "on 2024-05"))`,
+			expected: `"2024"`,
+		},
+		{
+			name:     "Regex replace with a function",
+			input:    `(re-replace #/\d+/ "a1b22" (func (f m) (str "<" (string-length m) ">")))`,
+			expected: `"a<1>b<2>"`,
+		},
+		{
+			name:     "Regex find all and split",
+			input:    `(count (re-find-all #/\d+/ (join "," (re-split #/\s+/ "1 22  333"))))`,
+			expected: "3",
+		},
+		{
+			name:     "re-split limits",
+			input:    `[(re-split #/,/ "a,b,c" 2) (re-split #/,/ "a,b,c" 0) (re-split #/,/ "a,b,c" -1)]`,
+			expected: `[("a" "b,c") ("a" "b" "c") ("a" "b" "c")]`,
+		},
+		{
+			name:     "Line comments",
+			input:    "; setup\n(def x 1) ; one\n(+ x 1) ; done",
+			expected: "2",
+		},
+		{
+			name:     "Nested block comments",
+			input:    "#| outer #| inner |# (def x 5) |# (def x 1) x",
+			expected: "1",
+		},
+		{
+			name:     "Datum comments skip the next form",
+			input:    "(+ 1 #_(* 100 2) 2 #_ #_ 3 4)",
+			expected: "3",
+		},
+		{
+			name:     "Semicolons inside strings are not comments",
+			input:    `"a;b"`,
+			expected: `"a;b"`,
+		},
+		{
+			name:     "Results print in readable form",
+			input:    `(quote (a "b" #\c nil 1.5))`,
+			expected: `(a "b" #\c nil 1.5)`,
+		},
+		{
+			name:     "Repr reads back as an equal value",
+			input:    `(= (read-string (repr '[1 "a\n" #\space {:k #{x}}])) '[1 "a\n" #\space {:k #{x}}])`,
+			expected: "true",
+		},
+		{
+			name:     "Quoted nil is falsy",
+			input:    `(vector (if 'nil 1 2) (if (nth '(nil) 0) 1 2) (= 'nil nil))`,
+			expected: "[2 2 true]",
+		},
+		{
+			name:     "Unreadable symbol names are written between bars",
+			input:    `(vector (string->symbol "12") (string->symbol "a b") (string->symbol "nil") (keyword "x|y z") 'plain)`,
+			expected: `[|12| |a b| |nil| :|x\|y z| plain]`,
+		},
+		{
+			name:     "Barred symbols read back as the same name",
+			input:    `(def s (string->symbol "a b")) (vector (= (read-string (repr s)) s) (symbol->string '|12|) (symbol? '|12|))`,
+			expected: `[true "12" true]`,
+		},
+		{
+			name:     "Records and variants read back equal",
+			input:    `(defrecord point x y) (deftype shape (circle r) none) (def v [(point 1 'two) (circle (point 3 nil)) none]) (= (read-string (repr v)) v)`,
+			expected: "true",
+		},
+		{
+			name:     "Read record fields are not evaluated",
+			input:    `(defrecord point x y) (point-x (read-string "#point{:x (+ 1 2) :y 0}"))`,
+			expected: "(+ 1 2)",
+		},
+		{
+			name:     "Records print as literals",
+			input:    `(do (defrecord point x y) (repr (point 1 "two")))`,
+			expected: `"#point{:x 1 :y \"two\"}"`,
+		},
+		{
+			name:     "Try catches errors",
+			input:    `(try (/ 1 0) (catch e (error-message e)))`,
+			expected: `"division by zero"`,
+		},
+		{
+			name:     "Try returns the body's value",
+			input:    `(try 1 2 (catch e 3))`,
+			expected: "2",
+		},
+		{
+			name:     "Thrown errors can be rethrown",
+			input:    `(try (try (throw "inner") (catch e (throw e))) (catch e (vector (error? e) (error-message e))))`,
+			expected: `[true "inner"]`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -47,9 +407,265 @@ func TestParseError(t *testing.T) {
 	}
 }
 
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"{(f) 1 (f) 2}", "1:1: duplicate key (f) in map literal"},
+		{"#{1 2 1}", "1:1: duplicate item 1 in set literal"},
+		{"(defrecord point x y) #point{:x 1 :x 2}", "1:23: duplicate field :x in record literal"},
+		{"(defrecord point x y x)", "duplicate field x in defrecord point"},
+		{"(deftype shape (rect w w))", "duplicate field w in variant rect"},
+		{"(+ 1 2)\n  #_ ; nothing follows", "2:3: unexpected EOF after #_"},
+		{"(def k 1) {k 2 1 3}", "duplicate key 1 in map literal"},
+		{"(def k 1) #{k 1}", "duplicate item 1 in set literal"},
+		{"(def t (transient {})) (persistent! t) (persistent! t)", "transient used after persistent!"},
+		{`(string->symbol "")`, "string->symbol requires a non-empty string"},
+		{`(symbol "a" "")`, "symbol requires non-empty names"},
+		{`(keyword "")`, "keyword requires a non-empty string"},
+		{"(pprint [1] 0)", "pprint width must be a positive integer"},
+		{"(pprint [1] 2.5)", "pprint width must be a positive integer"},
+		{"(pprint [1] 1e300)", "pprint width must be a positive integer"},
+		{`(re-split #/,/ "a,b" 1.5)`, "re-split limit must be an integer"},
+		{"(integer->char 4294967361)", "integer->char expects a valid code point, got 4.294967361e+09"},
+		{"'||", "1:2: empty name between bars"},
+		{"'|a b", "1:2: unterminated |name|"},
+		{`(read-string "#shape{}")`, "shape is not a record type or variant"},
+		{"(defrecord point x y) #point{:x 1 :z 2}", "point has no field :z"},
+		{`(defrecord point x y) (read-string "#point{:x 1 \"y\" 2}")`, `point has no field "y"`},
+		{"(defrecord point x y) #point{:x 1}", "#point{...} is missing field :y"},
+		{"(deftype shape (circle r) none) #circle{:r 1 :d 2}", "circle has no field :d"},
+		{"(deftype shape (circle r) none) #none{:r 1}", "none has no field :r"},
+		{`(format "~4611686018427387904a" 1)`, "format width or precision exceeds 10000"},
+		{`(format "~1,99999999999999999999f" 1)`, "format width or precision exceeds 10000"},
+		{`(fmt "{1:9223372036854775807}")`, "format width or precision exceeds 10000"},
+	}
+	for _, tt := range tests {
+		_, err := EvalString(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: got error %v, want %s", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	_, err := EvalString("(def x 1)\n  (print \"unterminated)")
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("Expected *SyntaxError, got %v", err)
+	}
+	if syntaxErr.Line != 2 || syntaxErr.Col != 10 {
+		t.Errorf("Expected error at 2:10, got %d:%d", syntaxErr.Line, syntaxErr.Col)
+	}
+}
+
+func TestCommentsKeepPositions(t *testing.T) {
+	_, err := EvalString("#| one\ntwo |# ; three\n   )")
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("Expected *SyntaxError, got %v", err)
+	}
+	if syntaxErr.Line != 3 || syntaxErr.Col != 4 {
+		t.Errorf("Expected error at 3:4, got %d:%d", syntaxErr.Line, syntaxErr.Col)
+	}
+}
+
+func TestHierarchyIsPerEnvironment(t *testing.T) {
+	if _, err := EvalString("(derive :test/dog :test/animal)"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := EvalString("(isa? :test/dog :test/animal)")
+	if err != nil || result != "false" {
+		t.Errorf("derive leaked into another environment: %s, %v", result, err)
+	}
+}
+
 func TestEvalError(t *testing.T) {
 	_, err := EvalString("(/ 1 0)")
 	if err == nil {
 		t.Error("Expected evaluation error (division by zero), got nil")
 	}
 }
+
+func TestMatchWarnsOnMissingVariant(t *testing.T) {
+	var buf bytes.Buffer
+	env := NewEnvironment(nil)
+	env.SetOutput(&buf)
+
+	_, err := evalString("(deftype shape (circle r) (rect w h) dot) (defn (r s) (match s ((circle r) r))) (r (circle 1)) (r (circle 2))", env)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "warning: match on shape does not handle rect, dot\n"; buf.String() != want {
+		t.Errorf("Expected one warning %q, got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	_, err = evalString("(deftype shape (circle r) (rect w h)) (match (circle 1) ((circle r) r) (_ 0))", env)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no warning with a wildcard clause, got %q", buf.String())
+	}
+
+	// Match forms built at run time are not remembered forever.
+	_, err = evalString("(deftype t a b) (defn (warn n) (if (> n 0) (do (eval (read-string \"(match a (a 1))\")) (warn (- n 1))))) (warn 2000)", env)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := len(env.state.warned); n > maxWarned {
+		t.Errorf("Expected at most %d remembered match forms, got %d", maxWarned, n)
+	}
+}
+
+func TestEvalInterrupted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := EvalStringContext(ctx, "(defn (spin n) (spin (+ n 1))) (spin 0)")
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected ErrInterrupted, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	spin := "(defn (spin n) (spin (+ n 1))) (spin 0)"
+	tests := []struct {
+		name   string
+		input  string
+		limits Limits
+		check  func(error) bool
+	}{
+		{
+			name:   "Step limit",
+			input:  spin,
+			limits: Limits{MaxSteps: 1000},
+			check:  func(err error) bool { var e *StepLimitError; return errors.As(err, &e) && e.Limit == 1000 },
+		},
+		{
+			name:   "Depth limit",
+			input:  spin,
+			limits: Limits{MaxDepth: 100},
+			check:  func(err error) bool { var e *DepthLimitError; return errors.As(err, &e) && e.Limit == 100 },
+		},
+		{
+			name:   "Allocation limit",
+			input:  `(defn (grow s) (grow (str s s))) (grow "ab")`,
+			limits: Limits{MaxAlloc: 1000},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) && e.Size == 1024 },
+		},
+		{
+			name:   "Padding is checked before it is allocated",
+			input:  `(format "~5000a" 1)`,
+			limits: Limits{MaxAlloc: 1000},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) && e.Size == 5000 },
+		},
+		{
+			name:   "Interpolation padding is checked before it is allocated",
+			input:  `(fmt "{1:>5000}")`,
+			limits: Limits{MaxAlloc: 1000},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) && e.Size == 5000 },
+		},
+		{
+			name:   "Replacements are checked before they are allocated",
+			input:  `(def s (join (vector "aaaaaaaaaa" "aaaaaaaaaa"))) (replace s "a" (join (vector s s s s s)))`,
+			limits: Limits{MaxAlloc: 1000},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) && e.Size == 2000 },
+		},
+		{
+			name:   "Joins are checked as they grow",
+			input:  `(def s "0123456789") (join (vector s s s s s s s s s s s s))`,
+			limits: Limits{MaxAlloc: 100},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) && e.Size == 110 },
+		},
+		{
+			name:   "Interned symbols count against the allocation limit",
+			input:  `(defn (mk n) (string->symbol (str "limits-symbol-" n)) (mk (+ n 1))) (mk 0)`,
+			limits: Limits{MaxAlloc: 1000},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) },
+		},
+		{
+			name:   "Interned keywords count against the allocation limit",
+			input:  `(defn (mk n) (keyword (str "limits-keyword-" n)) (mk (+ n 1))) (mk 0)`,
+			limits: Limits{MaxAlloc: 1000},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) },
+		},
+		{
+			name:   "Names read by read-string count against the allocation limit",
+			input:  `(defn (mk n) (read-string (str "limits-read-" n)) (mk (+ n 1))) (mk 0)`,
+			limits: Limits{MaxAlloc: 1000},
+			check:  func(err error) bool { var e *AllocLimitError; return errors.As(err, &e) },
+		},
+		{
+			name:   "Timeout",
+			input:  spin,
+			limits: Limits{Timeout: 20 * time.Millisecond},
+			check:  func(err error) bool { var e *TimeoutError; return errors.As(err, &e) },
+		},
+		{
+			name:   "Limits are not caught",
+			input:  "(defn (spin n) (try (spin (+ n 1)) (catch e 0))) (spin 0)",
+			limits: Limits{MaxSteps: 1000},
+			check:  func(err error) bool { var e *StepLimitError; return errors.As(err, &e) },
+		},
+		{
+			name:   "Within limits",
+			input:  "(defn (sq x) (* x x)) (sq 12)",
+			limits: Limits{MaxSteps: 100, MaxDepth: 10, MaxAlloc: 10, Timeout: time.Second},
+			check:  func(err error) bool { return err == nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := EvalStringLimits(context.Background(), tt.input, tt.limits)
+			if !tt.check(err) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	env, err := NewSandbox(SafeGroups...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"slurp", "spit", "eval"} {
+		if _, err := evalString("("+name+` "x")`, env); err == nil || err.Error() != "undefined name: "+name {
+			t.Errorf("Expected %s to be unbound, got %v", name, err)
+		}
+	}
+	if result, err := evalString(`(upper (str "a" 1))`, env); err != nil || result != `"A1"` {
+		t.Errorf(`Expected "A1", got %s (%v)`, result, err)
+	}
+
+	env, err = NewSandbox("strings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := evalString("(vector 1)", env); err == nil {
+		t.Error("Expected vector to be unbound outside the collections group")
+	}
+	if _, err := NewSandbox("network"); err == nil {
+		t.Error("Expected an error for an unknown group")
+	}
+}
+
+func TestEvalAndFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(eval '(+ 1 2))`, "3"},
+		{`(eval (read-string "(* 2 (+ 1 2))"))`, "6"},
+		{`(do (spit "` + path + `" (str "a" 1)) (slurp "` + path + `"))`, `"a1"`},
+	}
+	for _, tt := range tests {
+		result, err := EvalString(tt.input)
+		if err != nil || result != tt.expected {
+			t.Errorf("%s: expected %s, got %s (%v)", tt.input, tt.expected, result, err)
+		}
+	}
+}
@@ -1,102 +1,237 @@
-package main
+package yocto
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-func tokenize(input string) []string {
-	specialTokens := []string{"(", ")", "'", "`", ",", "&", "\"", "@"}
-	for _, token := range specialTokens {
-		input = strings.ReplaceAll(input, token, " "+token+" ")
-	}
-	return strings.Fields(input)
-}
-
-func parseExpr(tokens []string) (Expression, []string, error) {
+func parseExpr(tokens []Token) (Expression, []Token, error) {
 	if len(tokens) == 0 {
 		return nil, tokens, fmt.Errorf("unexpected EOF")
 	}
 	token := tokens[0]
 	tokens = tokens[1:]
-	switch token {
+	switch token.Text {
 	case "(":
-		var list List
-		for len(tokens) > 0 && tokens[0] != ")" {
-			expr, remaining, err := parseExpr(tokens)
-			if err != nil {
-				return nil, tokens, err
-			}
-			list = append(list, expr)
-			tokens = remaining
-		}
-		if len(tokens) == 0 {
-			return nil, tokens, fmt.Errorf("missing closing parenthesis")
+		items, remaining, err := parseSeq(token, tokens, ")")
+		if err != nil {
+			return nil, remaining, err
 		}
-		return list, tokens[1:], nil
+		return List(items), remaining, nil
 	case ")":
-		return nil, tokens, fmt.Errorf("unexpected closing parenthesis")
-	case "\"":
-		return parseString(token, tokens)
-	case "'":
-		expr, remaining, err := parseExpr(tokens)
+		return nil, tokens, syntaxError(token, "unexpected closing parenthesis")
+	case "[":
+		items, remaining, err := parseSeq(token, tokens, "]")
 		if err != nil {
-			return nil, tokens, err
+			return nil, remaining, err
+		}
+		return NewVector(items...), remaining, nil
+	case "]":
+		return nil, tokens, syntaxError(token, "unexpected closing bracket")
+	case "#{":
+		items, remaining, err := parseSeq(token, tokens, "}")
+		if err != nil {
+			return nil, remaining, err
 		}
-		return List{Name("quote"), expr}, remaining, nil
-	case "`":
+		set := NewSet(items...)
+		if set.Count() != len(items) {
+			return nil, remaining, syntaxError(token, "duplicate item "+Write(firstDuplicate(items))+" in set literal")
+		}
+		return set, remaining, nil
+	case "{":
+		return parseMap(token, tokens)
+	case "}":
+		return nil, tokens, syntaxError(token, "unexpected closing brace")
+	case "nil":
+		return nil, tokens, nil
+	case "true":
+		return Boolean(true), tokens, nil
+	case "false":
+		return Boolean(false), tokens, nil
+	case "'", "`", ",", ",@":
 		expr, remaining, err := parseExpr(tokens)
 		if err != nil {
 			return nil, tokens, err
 		}
-		return List{Name("quasiquote"), expr}, remaining, nil
-	case ",":
-		if len(tokens) > 0 && tokens[0] == "@" {
-			tokens = tokens[1:]
-			expr, remaining, err := parseExpr(tokens)
-			if err != nil {
-				return nil, tokens, err
+		return List{Intern(quoteForms[token.Text]), expr}, remaining, nil
+	}
+
+	switch token.Kind {
+	case TokenOpen:
+		// #name{field value ...}
+		items, remaining, err := parseSeq(token, tokens, "}")
+		if err != nil {
+			return nil, remaining, err
+		}
+		if len(items)%2 != 0 {
+			return nil, remaining, syntaxError(token, "record literal requires an even number of forms")
+		}
+		fields := Map{}.Transient()
+		for i := 0; i < len(items); i += 2 {
+			count := fields.count
+			fields.Assoc(items[i], items[i+1])
+			if fields.count == count {
+				return nil, remaining, syntaxError(token, "duplicate field "+Write(items[i])+" in record literal")
 			}
-			return List{Name("unquote-splicing"), expr}, remaining, nil
 		}
+		name := Intern(strings.TrimSuffix(token.Text[1:], "{"))
+		return RecordLiteral{name: name, fields: fields.Persistent()}, remaining, nil
+	case TokenString:
+		return String(token.Value), tokens, nil
+	case TokenNumber:
+		num, _ := parseNumber(token.Text)
+		return num, tokens, nil
+	case TokenChar:
+		c, err := parseChar(token.Text[2:])
+		if err != nil {
+			return nil, tokens, syntaxError(token, err.Error())
+		}
+		return c, tokens, nil
+	case TokenKeyword:
+		return InternKeyword(tokenName(token)), tokens, nil
+	case TokenRegex:
+		re, err := CompileRegex(token.Value)
+		if err != nil {
+			return nil, tokens, syntaxError(token, err.Error())
+		}
+		return re, tokens, nil
+	}
+	return Intern(tokenName(token)), tokens, nil
+}
+
+// tokenName returns the name a symbol or keyword token stands for.
+func tokenName(token Token) string {
+	switch {
+	case token.Value != "":
+		return token.Value
+	case token.Kind == TokenKeyword:
+		return token.Text[1:]
+	}
+	return token.Text
+}
+
+var quoteForms = map[string]string{
+	"'":  "quote",
+	"`":  "quasiquote",
+	",":  "unquote",
+	",@": "unquote-splicing",
+}
+
+var closingNames = map[string]string{
+	")": "parenthesis",
+	"]": "bracket",
+	"}": "brace",
+}
+
+func syntaxError(token Token, msg string) error {
+	return &SyntaxError{Line: token.Line, Col: token.Col, Msg: msg}
+}
+
+// parseSeq reads forms up to and including the closing token that matches
+// open.
+func parseSeq(open Token, tokens []Token, closing string) ([]Expression, []Token, error) {
+	var items []Expression
+	for len(tokens) > 0 && tokens[0].Text != closing {
 		expr, remaining, err := parseExpr(tokens)
 		if err != nil {
-			return nil, tokens, err
+			return nil, remaining, err
 		}
-		return List{Name("unquote"), expr}, remaining, nil
-	case "&":
-		return Name("&"), tokens, nil
-	default:
-		if num, err := strconv.ParseFloat(token, 64); err == nil {
-			return Number(num), tokens, nil
+		items = append(items, expr)
+		tokens = remaining
+	}
+	if len(tokens) == 0 {
+		return nil, tokens, syntaxError(open, "missing closing "+closingNames[closing])
+	}
+	return items, tokens[1:], nil
+}
+
+// charNames are the named character literals, as in #\newline.
+var charNames = map[string]Char{
+	"newline": '\n',
+	"space":   ' ',
+	"tab":     '\t',
+	"return":  '\r',
+	"nul":     0,
+}
+
+// parseChar reads #\a, a named character such as #\newline, or a code
+// point such as #\u00e9.
+func parseChar(text string) (Expression, error) {
+	if utf8.RuneCountInString(text) == 1 {
+		r, _ := utf8.DecodeRuneInString(text)
+		return Char(r), nil
+	}
+	if c, ok := charNames[text]; ok {
+		return c, nil
+	}
+	if strings.HasPrefix(text, "u") {
+		if code, err := strconv.ParseUint(text[1:], 16, 32); err == nil && utf8.ValidRune(rune(code)) {
+			return Char(code), nil
 		}
-		return Name(token), tokens, nil
 	}
+	return nil, fmt.Errorf("invalid character literal: #\\%s", text)
 }
 
-func parseString(firstToken string, remainingTokens []string) (Expression, []string, error) {
-	if strings.HasSuffix(firstToken, "\"") && len(firstToken) > 1 {
-		// Single-token string
-		return String(firstToken[1 : len(firstToken)-1]), remainingTokens, nil
+// parseMap reads the forms of a {k v ...} literal. Keys and values are
+// evaluated when the resulting Map is evaluated, so keys that are equal
+// forms are rejected here rather than silently merged.
+// parseNumber reads text in the reader's number syntax, reporting false
+// if it is not a number.
+func parseNumber(text string) (Number, bool) {
+	switch text {
+	case "##Inf":
+		return Number(math.Inf(1)), true
+	case "##-Inf":
+		return Number(math.Inf(-1)), true
+	case "##NaN":
+		return Number(math.NaN()), true
+	}
+	if !isNumber(text) {
+		return 0, false
 	}
+	num, _ := strconv.ParseFloat(text, 64)
+	return Number(num), true
+}
 
-	fullString := firstToken[1:] // Remove opening quote
-	for len(remainingTokens) > 0 {
-		token := remainingTokens[0]
-		remainingTokens = remainingTokens[1:]
-		if strings.HasSuffix(token, "\"") {
-			// End of string found
-			fullString += " " + token[:len(token)-1]
-			return String(fullString), remainingTokens, nil
+func parseMap(open Token, tokens []Token) (Expression, []Token, error) {
+	items, remaining, err := parseSeq(open, tokens, "}")
+	if err != nil {
+		return nil, remaining, err
+	}
+	if len(items)%2 != 0 {
+		return nil, remaining, syntaxError(open, "map literal requires an even number of forms")
+	}
+	t := Map{}.Transient()
+	for i := 0; i < len(items); i += 2 {
+		count := t.count
+		t.Assoc(items[i], items[i+1])
+		if t.count == count {
+			return nil, remaining, syntaxError(open, "duplicate key "+Write(items[i])+" in map literal")
 		}
-		fullString += " " + token
 	}
-	return nil, remainingTokens, fmt.Errorf("unterminated string")
+	return t.Persistent(), remaining, nil
+}
+
+// firstDuplicate returns the first item equal to an earlier one.
+func firstDuplicate(items []Expression) Expression {
+	for i, item := range items {
+		for _, earlier := range items[:i] {
+			if Equal(item, earlier) {
+				return item
+			}
+		}
+	}
+	return nil
 }
 
 func Parse(input string) (Expression, error) {
-	tokens := tokenize(input)
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
 	expr, _, err := parseExpr(tokens)
 	return expr, err
 }
@@ -0,0 +1,253 @@
+package yocto
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultWidth is the line width pprint and the REPL lay results out in.
+const DefaultWidth = 80
+
+// A doc is a layout in Wadler's "prettier printer" algebra: text, line
+// breaks that render as a space when their group fits on one line, nesting
+// and groups.
+type doc interface{}
+
+type (
+	docText string
+	docLine struct{}
+	// docHardLine always breaks, so a group containing one never renders
+	// flat. The formatter uses it after comments.
+	docHardLine struct{}
+	docConcat   []doc
+	docNest     struct {
+		indent int
+		doc    doc
+	}
+	// docAlign indents its contents to the column it starts at.
+	docAlign struct{ doc doc }
+	// docGroup renders its contents flat if they fit in the remaining
+	// width and breaks every line in it otherwise.
+	docGroup struct{ doc doc }
+)
+
+// bodyForms maps forms whose trailing arguments are a body to the number
+// of leading arguments kept on the first line, as in
+//
+//	(defn (f x)
+//	  body)
+var bodyForms = map[string]int{
+	"def": 1, "defn": 1, "func": 1, "defmacro": 1, "if": 1, "let": 1, "when": 1,
+	"match": 1, "do": 0, "defrecord": 1, "deftype": 1, "defprotocol": 1,
+	"extend-type": 2, "defmulti": 1, "defmethod": 2, "try": 0, "catch": 1,
+}
+
+// Pprint returns the readable form of expr, broken across lines so that it
+// fits in width columns where possible.
+func Pprint(expr Expression, width int) string {
+	var sb strings.Builder
+	renderDoc(&sb, exprDoc(expr), width)
+	return sb.String()
+}
+
+func exprDoc(expr Expression) doc {
+	switch e := expr.(type) {
+	case List:
+		return listDoc(e)
+	case Vector:
+		return seqDoc("[", itemDocs(e.Items()), "]")
+	case Set:
+		var items []doc
+		e.Each(func(item Expression) bool {
+			items = append(items, exprDoc(item))
+			return true
+		})
+		return seqDoc("#{", items, "}")
+	case Map:
+		return seqDoc("{", mapEntryDocs(e), "}")
+	case *Record:
+		var items []doc
+		for i, value := range e.values {
+			items = append(items, entryDoc(e.typ.fields[i], value))
+		}
+		return seqDoc("#"+e.typ.name.String()+"{", items, "}")
+	case RecordLiteral:
+		return seqDoc("#"+e.name.String()+"{", mapEntryDocs(e.fields), "}")
+	case *VariantValue:
+		var items []doc
+		for i, key := range e.variant.keywords() {
+			items = append(items, entryDoc(key, e.values[i]))
+		}
+		return seqDoc("#"+e.variant.name.String()+"{", items, "}")
+	}
+	return docText(Write(expr))
+}
+
+func itemDocs(items []Expression) []doc {
+	docs := make([]doc, len(items))
+	for i, item := range items {
+		docs[i] = exprDoc(item)
+	}
+	return docs
+}
+
+func mapEntryDocs(m Map) []doc {
+	var docs []doc
+	m.Each(func(k, v Expression) bool {
+		docs = append(docs, entryDoc(k, v))
+		return true
+	})
+	return docs
+}
+
+// entryDoc keeps a key with its value, so maps break between entries.
+func entryDoc(k, v Expression) doc {
+	return docGroup{docConcat{exprDoc(k), docNest{2, docConcat{docLine{}, exprDoc(v)}}}}
+}
+
+// seqDoc lays out items one per line, aligned after open, when they do not
+// fit on one line.
+func seqDoc(open string, items []doc, close string) doc {
+	return docGroup{docConcat{docText(open), docAlign{joinDocs(items)}, docText(close)}}
+}
+
+func joinDocs(docs []doc) doc {
+	result := docConcat{}
+	for i, d := range docs {
+		if i > 0 {
+			result = append(result, docLine{})
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// listDoc lays out a form. Body forms keep their leading arguments on the
+// first line and indent the body by two; other calls align their
+// arguments after the operator.
+func listDoc(l List) doc {
+	var name Name
+	ok := false
+	if len(l) > 0 {
+		name, ok = l[0].(Name)
+	}
+	if !ok {
+		return seqDoc("(", itemDocs(l), ")")
+	}
+	args := itemDocs(l[1:])
+	if n, body := bodyForms[name.String()]; body && len(args) > n {
+		header := docConcat{docText("(" + name.String())}
+		for _, arg := range args[:n] {
+			header = append(header, docText(" "), arg)
+		}
+		rest := docConcat{}
+		for _, arg := range args[n:] {
+			rest = append(rest, docLine{}, arg)
+		}
+		return docGroup{docConcat{header, docNest{2, rest}, docText(")")}}
+	}
+	if len(args) == 0 {
+		return docText("(" + name.String() + ")")
+	}
+	return docGroup{docConcat{docText("(" + name.String() + " "), docAlign{joinDocs(args)}, docText(")")}}
+}
+
+type docCmd struct {
+	indent int
+	flat   bool
+	doc    doc
+}
+
+// renderDoc writes d to sb. Indentation is written lazily, before the
+// next text, so blank lines carry no trailing spaces.
+func renderDoc(sb *strings.Builder, d doc, width int) {
+	col, indent := 0, 0
+	stack := []docCmd{{doc: d}}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case docText:
+			sb.WriteString(strings.Repeat(" ", indent))
+			sb.WriteString(string(d))
+			indent = 0
+			if i := strings.LastIndexByte(string(d), '\n'); i >= 0 {
+				col = utf8.RuneCountInString(string(d[i+1:]))
+			} else {
+				col += utf8.RuneCountInString(string(d))
+			}
+		case docLine:
+			if c.flat {
+				sb.WriteByte(' ')
+				col++
+			} else {
+				sb.WriteByte('\n')
+				col, indent = c.indent, c.indent
+			}
+		case docHardLine:
+			sb.WriteByte('\n')
+			col, indent = c.indent, c.indent
+		case docConcat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, docCmd{c.indent, c.flat, d[i]})
+			}
+		case docNest:
+			stack = append(stack, docCmd{c.indent + d.indent, c.flat, d.doc})
+		case docAlign:
+			stack = append(stack, docCmd{col, c.flat, d.doc})
+		case docGroup:
+			flat := docCmd{c.indent, true, d.doc}
+			if !c.flat && !fits(width-col, flat, stack) {
+				flat.flat = false
+			}
+			stack = append(stack, flat)
+		}
+	}
+}
+
+// fits reports whether next, followed by the commands on rest taken from
+// the top, reaches a line break before exceeding width columns. It walks
+// only as far as that, without copying rest, so laying out a document
+// stays linear.
+func fits(width int, next docCmd, rest []docCmd) bool {
+	stack := []docCmd{next}
+	for width >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case docText:
+			if i := strings.IndexByte(string(d), '\n'); i >= 0 {
+				return utf8.RuneCountInString(string(d[:i])) <= width
+			}
+			width -= utf8.RuneCountInString(string(d))
+		case docLine:
+			if !c.flat {
+				return true
+			}
+			width--
+		case docHardLine:
+			return !c.flat
+		case docConcat:
+			if len(d) > 1 {
+				stack = append(stack, docCmd{c.indent, c.flat, d[1:]})
+			}
+			if len(d) > 0 {
+				stack = append(stack, docCmd{c.indent, c.flat, d[0]})
+			}
+		case docNest:
+			stack = append(stack, docCmd{c.indent, c.flat, d.doc})
+		case docAlign:
+			stack = append(stack, docCmd{c.indent, c.flat, d.doc})
+		case docGroup:
+			stack = append(stack, docCmd{c.indent, true, d.doc})
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package yocto
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Printer renders expressions as text. A Readable printer produces the
+// form used by write and repr, which Parse reads back as an equal value.
+// Otherwise it produces the human form used by display and print, in
+// which strings and characters appear without quoting.
+type Printer struct {
+	Readable bool
+}
+
+// Write returns the readable form of expr.
+func Write(expr Expression) string {
+	return Printer{Readable: true}.Print(expr)
+}
+
+// Display returns the human form of expr.
+func Display(expr Expression) string {
+	return Printer{}.Print(expr)
+}
+
+func (p Printer) Print(expr Expression) string {
+	var sb strings.Builder
+	p.print(&sb, expr)
+	return sb.String()
+}
+
+func (p Printer) print(sb *strings.Builder, expr Expression) {
+	switch e := expr.(type) {
+	case nil:
+		sb.WriteString("nil")
+	case Boolean:
+		sb.WriteString(strconv.FormatBool(bool(e)))
+	case Number:
+		sb.WriteString(formatNumber(float64(e)))
+	case String:
+		if p.Readable {
+			sb.WriteString(strconv.Quote(string(e)))
+		} else {
+			sb.WriteString(string(e))
+		}
+	case Char:
+		if p.Readable {
+			sb.WriteString(writeChar(e))
+		} else {
+			sb.WriteRune(rune(e))
+		}
+	case Name:
+		if p.Readable {
+			sb.WriteString(writeName("", e.String(), TokenSymbol))
+		} else {
+			sb.WriteString(e.String())
+		}
+	case *Keyword:
+		if p.Readable {
+			sb.WriteString(writeName(":", e.name, TokenKeyword))
+		} else {
+			sb.WriteString(":" + e.name)
+		}
+	case List:
+		p.printSeq(sb, "(", e, ")")
+	case Vector:
+		p.printSeq(sb, "[", e.Items(), "]")
+	case Set:
+		var items []Expression
+		e.Each(func(item Expression) bool {
+			items = append(items, item)
+			return true
+		})
+		p.printSeq(sb, "#{", items, "}")
+	case Map:
+		var items []Expression
+		e.Each(func(k, v Expression) bool {
+			items = append(items, k, v)
+			return true
+		})
+		p.printSeq(sb, "{", items, "}")
+	case *Record:
+		var items []Expression
+		for i, value := range e.values {
+			items = append(items, e.typ.fields[i], value)
+		}
+		p.printSeq(sb, "#"+e.typ.name.String()+"{", items, "}")
+	case RecordLiteral:
+		var items []Expression
+		e.fields.Each(func(k, v Expression) bool {
+			items = append(items, k, v)
+			return true
+		})
+		p.printSeq(sb, "#"+e.name.String()+"{", items, "}")
+	case *VariantValue:
+		var items []Expression
+		for i, key := range e.variant.keywords() {
+			items = append(items, key, e.values[i])
+		}
+		p.printSeq(sb, "#"+e.variant.name.String()+"{", items, "}")
+	case *Regex:
+		sb.WriteString("#/" + escapeSlashes(e.re.String()) + "/")
+	case *Function:
+		if e.name != (Name{}) {
+			fmt.Fprintf(sb, "#<fn %v>", e.name)
+		} else {
+			sb.WriteString("#<fn>")
+		}
+	case Macro:
+		sb.WriteString("#<macro>")
+	case fmt.Stringer:
+		sb.WriteString(e.String())
+	default:
+		fmt.Fprintf(sb, "#<%T>", expr)
+	}
+}
+
+func (p Printer) printSeq(sb *strings.Builder, open string, items []Expression, close string) {
+	sb.WriteString(open)
+	for i, item := range items {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		p.print(sb, item)
+	}
+	sb.WriteString(close)
+}
+
+// formatNumber prints integers without an exponent and other numbers in
+// the shortest form that reads back exactly.
+func formatNumber(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "##Inf"
+	case math.IsInf(f, -1):
+		return "##-Inf"
+	case math.IsNaN(f):
+		return "##NaN"
+	case f == math.Trunc(f) && math.Abs(f) < 1e21:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// writeName returns prefix and name as the reader's text for a symbol or
+// keyword of the given kind. Names that would read back as something
+// else, such as 12, a b or nil, are written between bars.
+func writeName(prefix, name string, kind TokenKind) string {
+	text := prefix + name
+	tokens, err := lex(text)
+	if err == nil && len(tokens) == 1 && tokens[0].Kind == kind && tokens[0].Text == text && tokens[0].Value == "" {
+		switch text {
+		case "nil", "true", "false":
+		default:
+			return text
+		}
+	}
+	r := strings.NewReplacer(`\`, `\\`, "|", `\|`)
+	return prefix + "|" + r.Replace(name) + "|"
+}
+
+func writeChar(c Char) string {
+	for name, named := range charNames {
+		if named == c {
+			return `#\` + name
+		}
+	}
+	if unicode.IsPrint(rune(c)) {
+		return `#\` + string(rune(c))
+	}
+	return fmt.Sprintf(`#\u%04x`, rune(c))
+}
@@ -0,0 +1,212 @@
+package yocto
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzValue builds a data value from fuzz input, consuming bytes as it
+// goes. Only values that have a readable form are produced. Records and
+// variants are built from the types fuzzTypes defines in env.
+type fuzzValue struct {
+	data []byte
+	str  string
+	env  *Environment
+}
+
+const fuzzTypes = "(defrecord point x y) (deftype shape (circle r) (rect w h) none)"
+
+func (f *fuzzValue) byte() byte {
+	if len(f.data) == 0 {
+		return 0
+	}
+	b := f.data[0]
+	f.data = f.data[1:]
+	return b
+}
+
+// name returns the fuzz string or one of symbolNames, so names with
+// spaces, digits and delimiters are written as well as ordinary ones.
+func (f *fuzzValue) name() string {
+	b := f.byte()
+	if b%2 == 0 && f.str != "" {
+		return f.str
+	}
+	return symbolNames[int(b/2)%len(symbolNames)]
+}
+
+func (f *fuzzValue) lookup(name string) Expression {
+	value, _ := f.env.Get(Intern(name))
+	return value
+}
+
+func (f *fuzzValue) value(depth int) Expression {
+	kind := f.byte() % 14
+	if depth > 3 && kind > 7 {
+		kind %= 8
+	}
+	switch kind {
+	case 0:
+		return nil
+	case 1:
+		return Boolean(f.byte()%2 == 0)
+	case 2:
+		switch f.byte() % 8 {
+		case 0:
+			return Number(math.Inf(1))
+		case 1:
+			return Number(math.Inf(-1))
+		}
+		n := math.Float64frombits(uint64(f.byte())<<56 | uint64(f.byte())<<8 | uint64(f.byte()))
+		if math.IsNaN(n) {
+			n = 0
+		}
+		return Number(n)
+	case 3:
+		return String(f.str)
+	case 4:
+		r := rune(f.byte()) + rune(f.byte())<<8
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+		return Char(r)
+	case 5:
+		return Intern(f.name())
+	case 6:
+		return InternKeyword(f.name())
+	case 7:
+		pattern := regexPatterns[int(f.byte())%len(regexPatterns)]
+		if pattern == "" {
+			pattern = regexp.QuoteMeta(f.str)
+		}
+		if re, err := CompileRegex(pattern); err == nil {
+			return re
+		}
+		return String(pattern)
+	}
+	items := make([]Expression, f.byte()%4)
+	for i := range items {
+		items[i] = f.value(depth + 1)
+	}
+	switch kind {
+	case 8:
+		return List(items)
+	case 9:
+		return NewVector(items...)
+	case 10:
+		return NewSet(items...)
+	case 11:
+		record, _ := f.lookup("point").(*RecordType).New([]Expression{f.value(depth + 1), f.value(depth + 1)})
+		return record
+	case 12:
+		switch f.byte() % 3 {
+		case 0:
+			variant, _ := f.lookup("circle").(*Variant).New([]Expression{f.value(depth + 1)})
+			return variant
+		case 1:
+			variant, _ := f.lookup("rect").(*Variant).New([]Expression{f.value(depth + 1), f.value(depth + 1)})
+			return variant
+		}
+		return f.lookup("none")
+	}
+	t := Map{}.Transient()
+	for i := 0; i+1 < len(items); i += 2 {
+		t.Assoc(items[i], items[i+1])
+	}
+	return t.Persistent()
+}
+
+var symbolNames = []string{"a", "foo-bar", "x?", "set!", "<=", "*1", "é", "12", "a b", "nil", "|x|", `a\b`, "#_", ":k", "##Inf", "(", "#p{"}
+
+// regexPatterns are the patterns fuzzValue uses for regexes; "" stands
+// for the quoted fuzz string.
+var regexPatterns = []string{"", "a/b", `\d+/`, `[/\]]+`, `\\/`, "x|y"}
+
+func FuzzWriteRead(f *testing.F) {
+	f.Add([]byte{8, 3, 5, 1, 3, 4, 65, 0}, "hello")
+	f.Add([]byte{13, 2, 6, 1, 3}, "tab\there \"quoted\"")
+	f.Add([]byte{10, 3, 2, 2, 64, 1, 0, 4, 10, 0, 1, 0}, "\u00e9\U0001F600\x00")
+	f.Add([]byte{9, 3, 8, 1, 9, 0, 4, 32, 0}, `C:\dir`)
+	f.Add([]byte{11, 0, 12, 1, 2, 0, 5, 0}, "a b")
+	f.Add([]byte{9, 3, 7, 0, 7, 2, 12, 2}, "x/y")
+	f.Fuzz(func(t *testing.T, data []byte, s string) {
+		env := NewEnvironment(nil)
+		if _, err := evalString(fuzzTypes, env); err != nil {
+			t.Fatal(err)
+		}
+		value := (&fuzzValue{data: data, str: s, env: env}).value(0)
+		text := Write(value)
+		read, err := Parse(text)
+		if err == nil {
+			read, err = readLiterals(read, env)
+		}
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", text, err)
+		}
+		if !Equal(value, read) {
+			t.Fatalf("%s read back as %s", text, Write(read))
+		}
+	})
+}
+
+func TestPprint(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		width    int
+		expected string
+	}{
+		{
+			name:     "Short forms stay on one line",
+			input:    `(+ 1 (* 2 3))`,
+			width:    80,
+			expected: `(+ 1 (* 2 3))`,
+		},
+		{
+			name:     "Calls align arguments after the operator",
+			input:    `(+ (fib (- n 1)) (fib (- n 2)))`,
+			width:    20,
+			expected: "(+ (fib (- n 1))\n   (fib (- n 2)))",
+		},
+		{
+			name:     "Body forms indent their body",
+			input:    `(defn (f x) (if (< x 2) x (f (- x 1))))`,
+			width:    20,
+			expected: "(defn (f x)\n  (if (< x 2)\n    x\n    (f (- x 1))))",
+		},
+		{
+			name:     "Maps break between entries",
+			input:    `{:a "one" :b [1 2 3]}`,
+			width:    15,
+			expected: "{:a \"one\"\n :b [1 2 3]}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result := Pprint(expr, tt.width); result != tt.expected {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+// A group is measured only up to the end of the line, so laying out a long
+// vector takes time linear in its length.
+func TestPprintLongVector(t *testing.T) {
+	items := make([]Expression, 100000)
+	for i := range items {
+		items[i] = List{Intern("f"), Number(i)}
+	}
+	lines := strings.Split(Pprint(NewVector(items...), 20), "\n")
+	if len(lines) != len(items) || lines[0] != "[(f 0)" || lines[1] != " (f 1)" {
+		t.Errorf("Expected one item per line, got %d lines starting %q", len(lines), lines[:2])
+	}
+}
@@ -0,0 +1,135 @@
+package yocto
+
+import (
+	"container/list"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Regex is a compiled regular expression, written #/pattern/ in source.
+type Regex struct {
+	re *regexp.Regexp
+}
+
+// regexCacheSize is how many compiled patterns regexCache keeps.
+const regexCacheSize = 256
+
+// regexCache maps pattern strings to compiled regexes, so patterns built
+// at run time by re-pattern are only compiled once. It keeps the most
+// recently used regexCacheSize patterns.
+var regexCache = struct {
+	sync.Mutex
+	entries map[string]*list.Element // value is *Regex
+	order   *list.List               // most recently used first
+}{entries: make(map[string]*list.Element), order: list.New()}
+
+// CompileRegex compiles pattern. An escaped slash \/ is the same as a
+// plain one, and is stored as one so that the regex prints back exactly.
+func CompileRegex(pattern string) (*Regex, error) {
+	pattern = unescapeSlashes(pattern)
+	regexCache.Lock()
+	if e, ok := regexCache.entries[pattern]; ok {
+		regexCache.order.MoveToFront(e)
+		regexCache.Unlock()
+		return e.Value.(*Regex), nil
+	}
+	regexCache.Unlock()
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	compiled := &Regex{re: re}
+	regexCache.Lock()
+	defer regexCache.Unlock()
+	if e, ok := regexCache.entries[pattern]; ok {
+		return e.Value.(*Regex), nil
+	}
+	regexCache.entries[pattern] = regexCache.order.PushFront(compiled)
+	if regexCache.order.Len() > regexCacheSize {
+		oldest := regexCache.order.Remove(regexCache.order.Back()).(*Regex)
+		delete(regexCache.entries, oldest.re.String())
+	}
+	return compiled, nil
+}
+
+// unescapeSlashes replaces each \/ in pattern with /, leaving other
+// escapes alone.
+func unescapeSlashes(pattern string) string {
+	if !strings.Contains(pattern, `\/`) {
+		return pattern
+	}
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			if pattern[i+1] != '/' {
+				sb.WriteByte('\\')
+			}
+			i++
+		}
+		sb.WriteByte(pattern[i])
+	}
+	return sb.String()
+}
+
+// escapeSlashes escapes each unescaped / in pattern, for writing it
+// between the slashes of a #/pattern/ literal.
+func escapeSlashes(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			sb.WriteString(pattern[i : i+2])
+			i++
+		case pattern[i] == '/':
+			sb.WriteString(`\/`)
+		default:
+			sb.WriteByte(pattern[i])
+		}
+	}
+	return sb.String()
+}
+
+func (r *Regex) Evaluate(env *Environment) (Expression, error) {
+	return r, nil
+}
+
+func (r *Regex) String() string {
+	return Write(r)
+}
+
+// matchResult shapes the submatches of one match: the matched string when
+// the regex has no groups, a map from keyword to group when any group is
+// named, and otherwise a vector of the whole match followed by each group.
+// Groups that did not participate are nil.
+func (r *Regex) matchResult(s string, loc []int) Expression {
+	group := func(i int) Expression {
+		if loc[2*i] < 0 {
+			return nil
+		}
+		return String(s[loc[2*i]:loc[2*i+1]])
+	}
+	names := r.re.SubexpNames()
+	if len(names) == 1 {
+		return group(0)
+	}
+	hasNames := false
+	for _, name := range names {
+		hasNames = hasNames || name != ""
+	}
+	if hasNames {
+		t := Map{}.Transient()
+		for i, name := range names {
+			if name != "" {
+				t.Assoc(InternKeyword(name), group(i))
+			}
+		}
+		return t.Persistent()
+	}
+	v := Vector{}
+	for i := range names {
+		v = v.Conj(group(i))
+	}
+	return v
+}
@@ -0,0 +1,28 @@
+package yocto
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRegexCacheIsBounded(t *testing.T) {
+	first, err := CompileRegex("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*regexCacheSize; i++ {
+		if _, err := CompileRegex(fmt.Sprintf("p%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	regexCache.Lock()
+	size := regexCache.order.Len()
+	regexCache.Unlock()
+	if size != regexCacheSize {
+		t.Errorf("cache holds %d patterns, want %d", size, regexCacheSize)
+	}
+	again, _ := CompileRegex("first")
+	if again == first {
+		t.Error("the least recently used pattern was not evicted")
+	}
+}
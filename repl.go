@@ -0,0 +1,274 @@
+package yocto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = ". "
+)
+
+// REPL is an interactive session: the environment forms are evaluated in
+// and the state meta-commands such as :load work on.
+type REPL struct {
+	env      *Environment
+	out      io.Writer
+	lastLoad string   // the file :reload loads again
+	session  []string // inputs evaluated without error, for :save
+	quit     bool
+}
+
+func NewREPL(out io.Writer) *REPL {
+	r := &REPL{out: out}
+	r.reset()
+	return r
+}
+
+// The REPL binds *1, *2 and *3 to the last three results and *e to the
+// last error.
+var (
+	resultVars = []Name{Intern("*1"), Intern("*2"), Intern("*3")}
+	errorVar   = Intern("*e")
+)
+
+func (r *REPL) reset() {
+	r.env = NewEnvironment(nil)
+	r.env.SetOutput(r.out)
+	r.session = nil
+	for _, name := range append(resultVars, errorVar) {
+		r.env.Set(name, nil)
+	}
+}
+
+func (r *REPL) pushResult(result Expression) {
+	for i := len(resultVars) - 1; i > 0; i-- {
+		value, _ := r.env.Get(resultVars[i-1])
+		r.env.Set(resultVars[i], value)
+	}
+	r.env.Set(resultVars[0], result)
+}
+
+// setError binds *e to err, keeping its trace if it has one.
+func (r *REPL) setError(err error) {
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		evalErr = &EvalError{Err: err}
+	}
+	r.env.Set(errorVar, evalErr)
+}
+
+// Run reads and handles lines from the terminal until end of input or
+// :quit, keeping history in ~/.yocto_history.
+func (r *REPL) Run() error {
+	config := &readline.Config{
+		Prompt:                 prompt,
+		AutoComplete:           completer{r},
+		DisableAutoSaveHistory: true,
+	}
+	if colorEnabled(os.Stdout) {
+		config.Painter = highlighter{}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		config.HistoryFile = filepath.Join(home, ".yocto_history")
+	}
+	rl, err := readline.NewEx(config)
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	var lines []string
+	for !r.quit {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			// Ctrl-C discards the form being typed.
+			lines = nil
+			rl.SetPrompt(prompt)
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+		if _, _, ok := parseCommand(strings.TrimSpace(input)); !ok && !inputComplete(input) {
+			rl.SetPrompt(continuationPrompt)
+			continue
+		}
+		lines = nil
+		rl.SetPrompt(prompt)
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		rl.SaveHistory(historyEntry(input))
+		r.handleInterruptibly(input)
+	}
+	return nil
+}
+
+// handleInterruptibly handles input, aborting it if SIGINT arrives while
+// it runs. Outside evaluation readline reads Ctrl-C as a key instead.
+func (r *REPL) handleInterruptibly(input string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	r.HandleContext(ctx, input)
+}
+
+// Handle runs a meta-command or evaluates input and prints the result.
+func (r *REPL) Handle(input string) {
+	r.HandleContext(context.Background(), input)
+}
+
+// HandleContext is like Handle but stops evaluating with ErrInterrupted
+// when ctx is done.
+func (r *REPL) HandleContext(ctx context.Context, input string) {
+	r.env.SetContext(ctx)
+	defer r.env.SetContext(nil)
+	if cmd, arg, ok := parseCommand(input); ok {
+		if err := cmd.Run(r, arg); err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+		return
+	}
+	result, err := r.eval(input)
+	if err != nil {
+		r.setError(err)
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+	r.session = append(r.session, input)
+	r.pushResult(result)
+	fmt.Fprintln(r.out, Pprint(result, DefaultWidth))
+}
+
+// parseCommand returns the meta-command input runs and its argument, if
+// input starts with a colon and the name of one. Other input, such as a
+// keyword, is evaluated.
+func parseCommand(input string) (*Command, string, bool) {
+	if !strings.HasPrefix(input, ":") {
+		return nil, "", false
+	}
+	name, arg, _ := strings.Cut(input[1:], " ")
+	cmd, ok := commands[name]
+	return cmd, strings.TrimSpace(arg), ok
+}
+
+// eval evaluates every form in input and returns the last result.
+func (r *REPL) eval(input string) (Expression, error) {
+	var result Expression
+	err := evalForms(input, r.env, func(value Expression) {
+		result = value
+	})
+	return result, err
+}
+
+// inputComplete reports whether input can be evaluated as it is, or
+// whether the REPL should read more lines because a bracket, string or
+// block comment is still open. Other errors count as complete, so they
+// are reported rather than waited on.
+func inputComplete(input string) bool {
+	tokens, err := lex(input)
+	if err != nil {
+		return !strings.Contains(err.Error(), "unterminated")
+	}
+	depth := 0
+	for _, t := range tokens {
+		switch t.Kind {
+		case TokenOpen:
+			depth++
+		case TokenClose:
+			depth--
+		}
+	}
+	if depth > 0 {
+		return false
+	}
+	// A trailing quote or #_ still needs its form.
+	if n := len(tokens); n > 0 {
+		kind := tokens[n-1].Kind
+		return kind != TokenQuote && kind != TokenDatumComment
+	}
+	return true
+}
+
+// historyEntry joins a form typed over several lines into one line, as
+// the history file holds one entry per line. Input whose line breaks
+// matter, because they end a comment or are part of a string, is kept as
+// typed.
+func historyEntry(input string) string {
+	tokens, err := lex(input)
+	if err != nil {
+		return input
+	}
+	for _, t := range tokens {
+		if t.Kind == TokenComment || strings.Contains(t.Text, "\n") {
+			return input
+		}
+	}
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// completer completes the name before the cursor from the special forms
+// and the names bound in the REPL's environment.
+type completer struct {
+	repl *REPL
+}
+
+func (c completer) Do(line []rune, pos int) ([][]rune, int) {
+	start := pos
+	for start > 0 && !isDelimiter(line[start-1]) {
+		start--
+	}
+	prefix := string(line[start:pos])
+	if prefix == "" {
+		return nil, 0
+	}
+	var suffixes [][]rune
+	for _, name := range completions(prefix, c.repl.env) {
+		suffixes = append(suffixes, []rune(name[len(prefix):]))
+	}
+	return suffixes, len([]rune(prefix))
+}
+
+// completions returns the special forms and names bound in env that start
+// with prefix, sorted.
+func completions(prefix string, env *Environment) []string {
+	candidates := append([]string(nil), specialForms...)
+	for _, name := range env.Names() {
+		candidates = append(candidates, name.String())
+	}
+	sort.Strings(candidates)
+	var result []string
+	for i, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) && (i == 0 || candidate != candidates[i-1]) {
+			result = append(result, candidate)
+		}
+	}
+	return result
+}
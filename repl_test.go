@@ -0,0 +1,160 @@
+package yocto
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInputComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		complete bool
+	}{
+		{"(+ 1 2)", true},
+		{"(defn (f x)", false},
+		{"(defn (f x)\n  (* x x))", true},
+		{`(print "a (`, false},
+		{"#| open", false},
+		{"'", false},
+		{"[1 2 {:a", false},
+		{")", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if got := inputComplete(tt.input); got != tt.complete {
+			t.Errorf("inputComplete(%q) = %v, want %v", tt.input, got, tt.complete)
+		}
+	}
+}
+
+func TestHistoryEntry(t *testing.T) {
+	if got := historyEntry("(defn (f x)\n  (* x x))"); got != "(defn (f x) (* x x))" {
+		t.Errorf("Expected a single line, got %q", got)
+	}
+	input := "(f ; comment\n 1)"
+	if got := historyEntry(input); got != input {
+		t.Errorf("Expected input with a comment kept as typed, got %q", got)
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	env := NewEnvironment(nil)
+	env.Set(Intern("defaults"), Number(1))
+	line := []rune("(def")
+	completions, length := completer{&REPL{env: env}}.Do(line, len(line))
+	var got []string
+	for _, c := range completions {
+		got = append(got, string(c))
+	}
+	want := []string{"", "aults", "macro", "method", "multi", "n", "protocol", "record", "type"}
+	if length != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v of length 3, got %v of length %d", want, got, length)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lib.yoc")
+	if err := os.WriteFile(path, []byte("(def loaded 42)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(defn (sq x) "Squares x." (* x x))`, "#<fn sq>\n"},
+		{":doc sq", "(sq x): function\n  Squares x.\n"},
+		{":doc if", "if: special form\n"},
+		{":doc count", "count: builtin\n"},
+		{":type (sq 2)", "Number\n"},
+		{":load " + path, "loaded " + path + "\n"},
+		{":reload", "loaded " + path + "\n"},
+		{":env", "loaded = 42\nsq = #<fn sq>\n"},
+		{"(defmacro (unless c a b) (if c b a))", "#<macro>\n"},
+		{":expand (unless x 1 2)", "(if x 2 1)\n"},
+		{":save " + filepath.Join(dir, "session.yoc"), "saved 2 forms to " + filepath.Join(dir, "session.yoc") + "\n"},
+		{":reset", ""},
+		{":env", ""},
+		{`(print "after reset")`, "after reset\nnil\n"},
+		{":nope", ":nope\n"},
+		{":nope 1", "1\n"},
+	}
+
+	var out bytes.Buffer
+	r := NewREPL(&out)
+	for _, tt := range tests {
+		out.Reset()
+		r.Handle(tt.input)
+		if out.String() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, out.String())
+		}
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, "session.yoc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "(defn (sq x) \"Squares x.\" (* x x))\n(defmacro (unless c a b) (if c b a))\n"
+	if string(saved) != expected {
+		t.Errorf("Expected saved session %q, got %q", expected, saved)
+	}
+
+	r.Handle(":quit")
+	if !r.quit {
+		t.Error("Expected :quit to end the session")
+	}
+}
+
+func TestResultHistory(t *testing.T) {
+	var out bytes.Buffer
+	r := NewREPL(&out)
+	inputs := []string{
+		"1", "2", "3", "[*1 *2 *3]",
+		"(defn (inv x) (/ 1 x))", "(defn (f x) (inv (- x 1)))", "(f 1)",
+		"(type *e)", ":trace",
+	}
+	for _, input := range inputs {
+		r.Handle(input)
+	}
+	expected := "1\n2\n3\n[3 2 1]\n#<fn inv>\n#<fn f>\nError: division by zero\nError\n" +
+		"division by zero\n  in (inv (- x 1))\n  in (f 1)\n"
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	src := `(if x "s" 1) ; c`
+	expected := "(" + colorSpecial + "if" + colorReset + " x " + colorString + `"s"` + colorReset + " " +
+		colorNumber + "1" + colorReset + ") " + colorComment + "; c" + colorReset
+	if got := highlight(src, 0); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	// With the cursor after the inner ), its ( is marked.
+	got := highlight("(f (g))", 6)
+	expected = "(f " + colorMatch + "(" + colorReset + "g))"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm")
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, w := range []io.Writer{&bytes.Buffer{}, f} {
+		if colorEnabled(w) {
+			t.Errorf("Expected no color when writing to %T, which is not a terminal", w)
+		}
+	}
+}
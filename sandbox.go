@@ -0,0 +1,32 @@
+package yocto
+
+import "fmt"
+
+// SafeGroups are the builtin groups that give code no access to anything
+// outside the interpreter: every group except io and eval.
+var SafeGroups = []string{
+	"printing", "symbols", "keywords", "maps", "collections", "dispatch",
+	"strings", "formatting", "regex", "errors",
+}
+
+// NewSandbox returns an environment in which only the builtins in the
+// named groups are bound; others are simply undefined. Special forms are
+// always available. For untrusted code, combine it with SetLimits:
+//
+//	env, _ := NewSandbox(SafeGroups...)
+//	env.SetLimits(Limits{MaxSteps: 1e6, Timeout: time.Second})
+func NewSandbox(groups ...string) (*Environment, error) {
+	allowed := make(map[Name]*Builtin)
+	for _, group := range groups {
+		names, ok := builtinGroups[group]
+		if !ok {
+			return nil, fmt.Errorf("unknown builtin group: %s", group)
+		}
+		for _, name := range names {
+			allowed[name] = builtins[name]
+		}
+	}
+	env := NewEnvironment(nil)
+	env.state.allowed = allowed
+	return env, nil
+}
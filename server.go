@@ -0,0 +1,372 @@
+package yocto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// The server speaks a protocol modelled on nREPL. Each message is a JSON
+// object preceded by its length as a 4-byte big-endian integer. A client
+// sends requests with an op and an id; the server answers with any number
+// of responses carrying that id, the last of which has "done" in its
+// status.
+//
+// Ops:
+//
+//	clone      create a session; the response has new-session
+//	close      discard a session
+//	eval       evaluate code, sending a value per form and any output
+//	load-file  evaluate the contents of file; file-path names it in errors
+//	complete   list the names that start with prefix
+//	interrupt  abandon the eval running in a session
+//	describe   list the supported ops
+//
+// Eval, load-file and complete requests without a session get a new one,
+// named in the response. Sessions belong to the connection that created
+// them: closing it interrupts their evals and discards them.
+
+const maxMessageSize = 16 << 20
+
+var serverOps = []string{"clone", "close", "eval", "load-file", "complete", "interrupt", "describe"}
+
+type request struct {
+	Op          string `json:"op"`
+	ID          string `json:"id,omitempty"`
+	Session     string `json:"session,omitempty"`
+	Code        string `json:"code,omitempty"`
+	File        string `json:"file,omitempty"`
+	FilePath    string `json:"file-path,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	InterruptID string `json:"interrupt-id,omitempty"`
+}
+
+type response struct {
+	ID          string   `json:"id,omitempty"`
+	Session     string   `json:"session,omitempty"`
+	NewSession  string   `json:"new-session,omitempty"`
+	Value       string   `json:"value,omitempty"`
+	Out         string   `json:"out,omitempty"`
+	Err         string   `json:"err,omitempty"`
+	Completions []string `json:"completions,omitempty"`
+	Ops         []string `json:"ops,omitempty"`
+	Status      []string `json:"status,omitempty"`
+}
+
+func readMessage(r io.Reader, v interface{}) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxMessageSize {
+		return fmt.Errorf("message of %d bytes is too large", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func writeMessage(w io.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	message := make([]byte, 4, 4+len(body))
+	binary.BigEndian.PutUint32(message, uint32(len(body)))
+	_, err = w.Write(append(message, body...))
+	return err
+}
+
+// DefaultServerLimits are the limits a Server applies to each eval unless
+// SetLimits replaces them. Bounding the call depth keeps runaway
+// recursion from overflowing the Go stack, which would end the process
+// and every session in it.
+var DefaultServerLimits = Limits{MaxDepth: 10000}
+
+// Server serves REPL sessions over network connections.
+type Server struct {
+	limits Limits
+}
+
+func NewServer() *Server {
+	return &Server{limits: DefaultServerLimits}
+}
+
+// SetLimits sets the limits applied to each eval in the sessions of
+// connections accepted afterwards.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = limits
+}
+
+// connection is the state of one client connection. Only the goroutine
+// reading its requests uses sessions.
+type connection struct {
+	send     func(response)
+	limits   Limits
+	sessions map[string]*session
+}
+
+func newConnection(send func(response), limits Limits) *connection {
+	return &connection{send: send, limits: limits, sessions: make(map[string]*session)}
+}
+
+// session is an environment shared by the requests naming it. Evals in a
+// session run one at a time, in the order they were received.
+type session struct {
+	id     string
+	env    *Environment
+	limits Limits
+
+	turnMu         sync.Mutex
+	turn           *sync.Cond
+	queued, served int // turns taken and finished
+
+	mu      sync.Mutex // guards the fields below
+	current string     // id of the running eval
+	reply   func(response)
+	cancel  context.CancelFunc
+	closed  bool
+}
+
+// Serve accepts connections on l until it fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+	var writeMu sync.Mutex
+	c := newConnection(func(resp response) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		writeMessage(conn, resp)
+	}, s.limits)
+	defer c.closeSessions()
+	for {
+		var req request
+		if err := readMessage(conn, &req); err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.send(response{Err: err.Error(), Status: []string{"error", "done"}})
+			}
+			return
+		}
+		c.handle(req)
+	}
+}
+
+func (c *connection) handle(req request) {
+	reply := func(resp response) {
+		resp.ID = req.ID
+		if resp.Session == "" {
+			resp.Session = req.Session
+		}
+		c.send(resp)
+	}
+	switch req.Op {
+	case "describe":
+		reply(response{Ops: serverOps, Status: []string{"done"}})
+		return
+	case "clone":
+		sess := c.newSession()
+		reply(response{NewSession: sess.id, Status: []string{"done"}})
+		return
+	case "close", "eval", "load-file", "complete", "interrupt":
+	default:
+		reply(response{Status: []string{"error", "unknown-op", "done"}})
+		return
+	}
+
+	sess := c.sessions[req.Session]
+	if sess == nil {
+		if req.Session != "" || req.Op == "close" || req.Op == "interrupt" {
+			reply(response{Status: []string{"error", "unknown-session", "done"}})
+			return
+		}
+		sess = c.newSession()
+		req.Session = sess.id
+	}
+	switch req.Op {
+	case "close":
+		delete(c.sessions, sess.id)
+		sess.close()
+		reply(response{Status: []string{"session-closed", "done"}})
+	case "eval":
+		go sess.eval(sess.takeTurn(), req.ID, req.Code, reply)
+	case "load-file":
+		go sess.eval(sess.takeTurn(), req.ID, req.File, func(resp response) {
+			if resp.Err != "" && req.FilePath != "" {
+				resp.Err = req.FilePath + ": " + resp.Err
+			}
+			reply(resp)
+		})
+	case "complete":
+		go sess.complete(sess.takeTurn(), req.Prefix, reply)
+	case "interrupt":
+		reply(response{Status: append(sess.interrupt(req.InterruptID), "done")})
+	}
+}
+
+func (c *connection) newSession() *session {
+	var b [8]byte
+	rand.Read(b[:])
+	sess := &session{id: hex.EncodeToString(b[:]), env: NewEnvironment(nil), limits: c.limits}
+	sess.turn = sync.NewCond(&sess.turnMu)
+	sess.env.SetOutput(sessionOutput{sess})
+	c.sessions[sess.id] = sess
+	return sess
+}
+
+// closeSessions closes every session of the connection once it has
+// closed.
+func (c *connection) closeSessions() {
+	for id, sess := range c.sessions {
+		delete(c.sessions, id)
+		sess.close()
+	}
+}
+
+// takeTurn reserves the next turn to evaluate in the session.
+func (sess *session) takeTurn() int {
+	sess.turnMu.Lock()
+	defer sess.turnMu.Unlock()
+	sess.queued++
+	return sess.queued - 1
+}
+
+// wait blocks until turn comes up. Each wait must be matched by a call to
+// endTurn.
+func (sess *session) wait(turn int) {
+	sess.turnMu.Lock()
+	defer sess.turnMu.Unlock()
+	for sess.served != turn {
+		sess.turn.Wait()
+	}
+}
+
+func (sess *session) endTurn() {
+	sess.turnMu.Lock()
+	defer sess.turnMu.Unlock()
+	sess.served++
+	sess.turn.Broadcast()
+}
+
+// complete waits for its turn, since evals write the environment it
+// reads, then replies with the names that start with prefix.
+func (sess *session) complete(turn int, prefix string, reply func(response)) {
+	sess.wait(turn)
+	defer sess.endTurn()
+	reply(response{Completions: completions(prefix, sess.env), Status: []string{"done"}})
+}
+
+// eval waits for its turn, then evaluates code in the session, replying
+// with the value of each form, any output and the first error.
+func (sess *session) eval(turn int, id, code string, reply func(response)) {
+	sess.wait(turn)
+	defer sess.endTurn()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return
+	}
+	sess.env.SetLimits(sess.limits)
+	sess.env.SetContext(ctx)
+	sess.current, sess.reply, sess.cancel = id, reply, cancel
+	sess.mu.Unlock()
+
+	err := evalRecovering(code, sess.env, func(result Expression) {
+		sess.send(id, response{Value: Write(result)})
+	})
+	if err != nil {
+		sess.send(id, response{Err: err.Error(), Status: []string{"eval-error"}})
+	}
+	sess.send(id, response{Status: []string{"done"}})
+
+	sess.mu.Lock()
+	sess.current, sess.reply, sess.cancel = "", nil, nil
+	sess.mu.Unlock()
+}
+
+// evalRecovering is evalForms with a panic in the evaluator reported as
+// an error, so that it fails the eval rather than the server.
+func evalRecovering(code string, env *Environment, emit func(Expression)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return evalForms(code, env, emit)
+}
+
+// close interrupts the running eval, without replying to it, and stops
+// queued evals from running.
+func (sess *session) close() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.closed = true
+	if sess.cancel != nil {
+		sess.cancel()
+	}
+	sess.reply = nil
+}
+
+// send replies to the eval with the given id, unless it has been
+// interrupted.
+func (sess *session) send(id string, resp response) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.current == id && sess.reply != nil {
+		sess.reply(resp)
+	}
+}
+
+// interrupt stops the running eval, if its id matches evalID or evalID is
+// empty, and returns the status to report. The eval is told it was
+// interrupted and gets no further responses.
+func (sess *session) interrupt(evalID string) []string {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.reply == nil {
+		return []string{"session-idle"}
+	}
+	if evalID != "" && evalID != sess.current {
+		return []string{"interrupt-id-mismatch"}
+	}
+	sess.cancel()
+	sess.reply(response{Status: []string{"interrupted", "done"}})
+	sess.reply = nil
+	return nil
+}
+
+// sessionOutput sends what code in a session prints to the client as out
+// responses for the running eval.
+type sessionOutput struct {
+	sess *session
+}
+
+func (w sessionOutput) Write(p []byte) (int, error) {
+	w.sess.mu.Lock()
+	defer w.sess.mu.Unlock()
+	if w.sess.reply != nil {
+		w.sess.reply(response{Out: string(p)})
+	}
+	return len(p), nil
+}
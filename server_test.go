@@ -0,0 +1,256 @@
+package yocto
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient sends requests to a server on a localhost listener.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func newTestClient(t *testing.T) *testClient {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go NewServer().Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t, conn}
+}
+
+// call sends req and returns the responses up to the one marked done.
+func (c *testClient) call(req request) []response {
+	if err := writeMessage(c.conn, req); err != nil {
+		c.t.Fatal(err)
+	}
+	var responses []response
+	for {
+		var resp response
+		if err := readMessage(c.conn, &resp); err != nil {
+			c.t.Fatal(err)
+		}
+		if resp.ID != req.ID {
+			c.t.Fatalf("Expected a response to %s, got %+v", req.ID, resp)
+		}
+		responses = append(responses, resp)
+		for _, status := range resp.Status {
+			if status == "done" {
+				return responses
+			}
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	c := newTestClient(t)
+
+	resp := c.call(request{Op: "describe", ID: "1"})
+	if !reflect.DeepEqual(resp[0].Ops, serverOps) {
+		t.Errorf("Expected ops %v, got %+v", serverOps, resp)
+	}
+
+	session := c.call(request{Op: "clone", ID: "2"})[0].NewSession
+	if session == "" {
+		t.Fatal("Expected clone to return a session")
+	}
+
+	var values []string
+	var out string
+	for _, r := range c.call(request{Op: "eval", ID: "3", Session: session, Code: `(def x 2) (print "hi") (* x 21)`}) {
+		if r.Value != "" {
+			values = append(values, r.Value)
+		}
+		out += r.Out
+	}
+	if !reflect.DeepEqual(values, []string{"2", "nil", "42"}) || out != "hi\n" {
+		t.Errorf("Expected values [2 nil 42] and output \"hi\\n\", got %v and %q", values, out)
+	}
+
+	// Each session has its own environment.
+	resp = c.call(request{Op: "eval", ID: "4", Code: "x"})
+	if resp[0].Err != "undefined name: x" || resp[0].Session == session || resp[0].Session == "" {
+		t.Errorf("Expected x to be undefined in a new session, got %+v", resp)
+	}
+
+	resp = c.call(request{Op: "complete", ID: "5", Session: session, Prefix: "x"})
+	if !reflect.DeepEqual(resp[0].Completions, []string{"x"}) {
+		t.Errorf("Expected completions [x], got %+v", resp)
+	}
+
+	resp = c.call(request{Op: "load-file", ID: "6", Session: session, File: "(car)", FilePath: "a.yoc"})
+	if resp[0].Err != "a.yoc: undefined name: car" {
+		t.Errorf("Expected an error naming the file, got %+v", resp)
+	}
+
+	resp = c.call(request{Op: "interrupt", ID: "7", Session: session})
+	if !reflect.DeepEqual(resp[0].Status, []string{"session-idle", "done"}) {
+		t.Errorf("Expected the session to be idle, got %+v", resp)
+	}
+
+	c.call(request{Op: "close", ID: "8", Session: session})
+	resp = c.call(request{Op: "eval", ID: "9", Session: session, Code: "x"})
+	if !reflect.DeepEqual(resp[0].Status, []string{"error", "unknown-session", "done"}) {
+		t.Errorf("Expected the session to be closed, got %+v", resp)
+	}
+}
+
+func TestServerInterrupt(t *testing.T) {
+	c := newTestClient(t)
+	session := c.call(request{Op: "clone", ID: "1"})[0].NewSession
+
+	// Wait for the eval to start printing before interrupting it.
+	code := spin + ` (print "started") (spin 100)`
+	if err := writeMessage(c.conn, request{Op: "eval", ID: "2", Session: session, Code: code}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var resp response
+		if err := readMessage(c.conn, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Out != "" {
+			break
+		}
+	}
+	if err := writeMessage(c.conn, request{Op: "interrupt", ID: "3", Session: session}); err != nil {
+		t.Fatal(err)
+	}
+	var statuses [][]string
+	for len(statuses) < 2 {
+		var resp response
+		if err := readMessage(c.conn, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Status) > 0 {
+			statuses = append(statuses, append([]string{resp.ID}, resp.Status...))
+		}
+	}
+	expected := [][]string{{"2", "interrupted", "done"}, {"3", "done"}}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected %v, got %v", expected, statuses)
+	}
+
+	// The session is free again once the interrupted eval has stopped.
+	resp := c.call(request{Op: "eval", ID: "4", Session: session, Code: "(+ 1 2)"})
+	if resp[0].Value != "3" {
+		t.Errorf("Expected 3, got %+v", resp)
+	}
+}
+
+// spin defines a function that runs for a very long time without nesting
+// calls deeply enough to reach DefaultServerLimits.
+const spin = "(defn (spin n) (if (= n 0) 0 (+ (spin (- n 1)) (spin (- n 1)))))"
+
+// connectionResponses returns a connection whose responses are sent on
+// the returned channel.
+func connectionResponses() (*connection, chan response) {
+	responses := make(chan response, 100)
+	return newConnection(func(resp response) { responses <- resp }, DefaultServerLimits), responses
+}
+
+func TestServerEvalPanic(t *testing.T) {
+	c, responses := connectionResponses()
+	c.handle(request{Op: "clone", ID: "1"})
+	session := (<-responses).NewSession
+	c.sessions[session].env.Set(Intern("boom"), &Builtin{name: "boom", fn: func(args []Expression, env *Environment) (Expression, error) {
+		panic("kaboom")
+	}})
+
+	c.handle(request{Op: "eval", ID: "2", Session: session, Code: "(boom)"})
+	resp := <-responses
+	if resp.Err != "panic: kaboom" || !reflect.DeepEqual(resp.Status, []string{"eval-error"}) {
+		t.Errorf("Expected the panic as an eval-error, got %+v", resp)
+	}
+	if resp := <-responses; !reflect.DeepEqual(resp.Status, []string{"done"}) {
+		t.Errorf("Expected done, got %+v", resp)
+	}
+}
+
+func TestServerSessionsEndWithConnection(t *testing.T) {
+	c, responses := connectionResponses()
+	c.handle(request{Op: "frobnicate", ID: "1"})
+	c.handle(request{Op: "interrupt", ID: "2"})
+	c.handle(request{Op: "close", ID: "3"})
+	if len(c.sessions) != 0 {
+		t.Fatalf("Expected no sessions for requests that do not need one, got %d", len(c.sessions))
+	}
+	for _, expected := range [][]string{{"error", "unknown-op", "done"}, {"error", "unknown-session", "done"}, {"error", "unknown-session", "done"}} {
+		if resp := <-responses; !reflect.DeepEqual(resp.Status, expected) {
+			t.Errorf("Expected status %v, got %+v", expected, resp)
+		}
+	}
+
+	c.handle(request{Op: "eval", ID: "4", Code: spin + " (spin 100)"})
+	c.handle(request{Op: "eval", ID: "5", Session: (<-responses).Session, Code: "(spin 100)"})
+	if len(c.sessions) != 1 {
+		t.Fatalf("Expected the eval to create one session, got %d", len(c.sessions))
+	}
+	var sess *session
+	for _, s := range c.sessions {
+		sess = s
+	}
+	c.closeSessions()
+	if len(c.sessions) != 0 {
+		t.Errorf("Expected the sessions to be discarded, got %d", len(c.sessions))
+	}
+
+	// Both the running and the queued eval stop.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sess.turnMu.Lock()
+		served := sess.served
+		sess.turnMu.Unlock()
+		if served == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the evals to stop, %d of 2 finished", served)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServerLimitsRecursion(t *testing.T) {
+	c := newTestClient(t)
+	resp := c.call(request{Op: "eval", ID: "1", Code: "(defn (f n) (f n)) (f 0)"})
+	if resp[1].Err != "call depth limit of 10000 exceeded" {
+		t.Errorf("Expected a depth limit error, got %+v", resp)
+	}
+}
+
+func TestServerCompleteDuringEval(t *testing.T) {
+	c, responses := connectionResponses()
+	c.handle(request{Op: "clone", ID: "1"})
+	session := (<-responses).NewSession
+	var code strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&code, "(def complete-%d %d) ", i, i)
+	}
+	c.handle(request{Op: "eval", ID: "2", Session: session, Code: code.String()})
+	for i := 0; i < 20; i++ {
+		c.handle(request{Op: "complete", ID: "3", Session: session, Prefix: "complete-99"})
+	}
+	// Completions wait for the eval, so each sees every definition.
+	for completed := 0; completed < 20; {
+		resp := <-responses
+		if resp.ID != "3" {
+			continue
+		}
+		completed++
+		if len(resp.Completions) != 11 {
+			t.Fatalf("Expected 11 completions, got %v", resp.Completions)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package yocto
+
+import "fmt"
+
+// Set is an immutable hash set, stored as a Map from each element to
+// itself. The zero value is an empty set.
+type Set struct {
+	m Map
+}
+
+func NewSet(items ...Expression) Set {
+	t := Map{}.Transient()
+	for _, item := range items {
+		t.Assoc(item, item)
+	}
+	return Set{m: t.Persistent()}
+}
+
+// Evaluate evaluates every element, so #{a b} produces a set of values.
+func (s Set) Evaluate(env *Environment) (Expression, error) {
+	t := Map{}.Transient()
+	var err error
+	s.Each(func(item Expression) bool {
+		var value Expression
+		if value, err = evaluate(item, env); err != nil {
+			return false
+		}
+		count := t.count
+		t.Assoc(value, value)
+		if t.count == count {
+			err = fmt.Errorf("duplicate item %s in set literal", Write(value))
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Set{m: t.Persistent()}, nil
+}
+
+func (s Set) String() string {
+	return Write(s)
+}
+
+func (s Set) Count() int {
+	return s.m.Count()
+}
+
+func (s Set) Contains(item Expression) bool {
+	_, ok := s.m.Get(item)
+	return ok
+}
+
+func (s Set) Conj(item Expression) Set {
+	return Set{m: s.m.Assoc(item, item)}
+}
+
+func (s Set) Disj(item Expression) Set {
+	return Set{m: s.m.Dissoc(item)}
+}
+
+// Each calls fn for every element until fn returns false.
+func (s Set) Each(fn func(item Expression) bool) {
+	s.m.Each(func(k, v Expression) bool {
+		return fn(k)
+	})
+}
@@ -0,0 +1,102 @@
+package yocto
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Name is a symbol. Names are interned in a global table, so comparing
+// and hashing them, and looking them up in an Environment, works on a
+// small integer instead of the string.
+type Name struct {
+	id uint32
+}
+
+var symbols = struct {
+	sync.RWMutex
+	ids   map[string]uint32
+	names []string
+}{
+	// id 0 is the zero Name, used where "no name" is meant.
+	ids:   map[string]uint32{"": 0},
+	names: []string{""},
+}
+
+// Intern returns the unique Name for s. A name of the form ns/local is a
+// namespaced symbol.
+func Intern(s string) Name {
+	symbols.RLock()
+	id, ok := symbols.ids[s]
+	symbols.RUnlock()
+	if ok {
+		return Name{id}
+	}
+
+	symbols.Lock()
+	defer symbols.Unlock()
+	if id, ok := symbols.ids[s]; ok {
+		return Name{id}
+	}
+	id = uint32(len(symbols.names))
+	symbols.ids[s] = id
+	symbols.names = append(symbols.names, s)
+	return Name{id}
+}
+
+// symbolInterned reports whether s already has a Name.
+func symbolInterned(s string) bool {
+	symbols.RLock()
+	defer symbols.RUnlock()
+	_, ok := symbols.ids[s]
+	return ok
+}
+
+var gensymCounter struct {
+	sync.Mutex
+	n int
+}
+
+// Gensym returns a fresh name for use in macro expansions. The name is
+// uninterned: it prints as prefix__n but is not equal to any name read
+// from source, even one with the same text.
+func Gensym(prefix string) Name {
+	gensymCounter.Lock()
+	gensymCounter.n++
+	s := fmt.Sprintf("%s__%d", prefix, gensymCounter.n)
+	gensymCounter.Unlock()
+
+	symbols.Lock()
+	defer symbols.Unlock()
+	id := uint32(len(symbols.names))
+	symbols.names = append(symbols.names, s)
+	return Name{id}
+}
+
+func (n Name) String() string {
+	symbols.RLock()
+	defer symbols.RUnlock()
+	return symbols.names[n.id]
+}
+
+// Namespace returns the ns part of ns/local, or "" for a plain name.
+func (n Name) Namespace() string {
+	ns, _ := splitSymbol(n.String())
+	return ns
+}
+
+// Local returns the part of the name after the namespace.
+func (n Name) Local() string {
+	_, local := splitSymbol(n.String())
+	return local
+}
+
+// splitSymbol splits ns/local at the first slash. The division operator
+// "/" and names with an empty half have no namespace.
+func splitSymbol(s string) (string, string) {
+	i := strings.Index(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return "", s
+	}
+	return s[:i], s[i+1:]
+}
@@ -0,0 +1,71 @@
+package yocto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EvalError is an evaluation error together with the calls that were in
+// progress when it happened, innermost first. It is also a value, which
+// the REPL binds to *e.
+type EvalError struct {
+	Err   error
+	Trace []List
+}
+
+func (e *EvalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+func (e *EvalError) Evaluate(env *Environment) (Expression, error) {
+	return e, nil
+}
+
+func (e *EvalError) String() string {
+	return fmt.Sprintf("#<error %s>", e.Err)
+}
+
+// Traceback returns the error message followed by one line per call in
+// the trace.
+func (e *EvalError) Traceback() string {
+	var sb strings.Builder
+	sb.WriteString(e.Err.Error())
+	for _, call := range e.Trace {
+		sb.WriteString("\n  in " + Write(call))
+	}
+	return sb.String()
+}
+
+// traceError adds call to the trace of err, wrapping err in an EvalError
+// if it is not one already.
+func traceError(err error, call List) error {
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		evalErr = &EvalError{Err: err}
+	}
+	evalErr.Trace = append(evalErr.Trace, call)
+	return evalErr
+}
+
+// catchable reports whether try may catch err. Interrupts and exceeded
+// limits have to end the evaluation, so they are not.
+func (env *Environment) catchable(err error) bool {
+	var (
+		steps   *StepLimitError
+		depth   *DepthLimitError
+		alloc   *AllocLimitError
+		timeout *TimeoutError
+	)
+	switch {
+	case errors.Is(err, ErrInterrupted), errors.As(err, &steps), errors.As(err, &depth),
+		errors.As(err, &alloc), errors.As(err, &timeout):
+		return false
+	}
+	ctx := env.state.ctx
+	return ctx == nil || ctx.Err() == nil
+}
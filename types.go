@@ -1,13 +1,57 @@
-package main
+package yocto
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
 
-type Name string
 type Number float64
 type List []Expression
 type String string
+type Char rune
 type Boolean bool
 
+// Keyword is a self-evaluating symbol such as :name. Keywords are interned,
+// so two keywords with the same name are the same pointer.
+type Keyword struct {
+	name string
+}
+
+var keywords = struct {
+	sync.Mutex
+	table map[string]*Keyword
+}{table: make(map[string]*Keyword)}
+
+// InternKeyword returns the unique keyword with the given name, without
+// the leading colon.
+func InternKeyword(name string) *Keyword {
+	keywords.Lock()
+	defer keywords.Unlock()
+	if k, ok := keywords.table[name]; ok {
+		return k
+	}
+	k := &Keyword{name: name}
+	keywords.table[name] = k
+	return k
+}
+
+// keywordInterned reports whether the keyword named name exists.
+func keywordInterned(name string) bool {
+	keywords.Lock()
+	defer keywords.Unlock()
+	_, ok := keywords.table[name]
+	return ok
+}
+
+func (k *Keyword) Evaluate(env *Environment) (Expression, error) {
+	return k, nil
+}
+
+func (k *Keyword) String() string {
+	return Write(k)
+}
+
 func (b Boolean) Evaluate(env *Environment) (Expression, error) {
 	return b, nil
 }
@@ -28,10 +72,44 @@ func (s String) Evaluate(env *Environment) (Expression, error) {
 	return s, nil
 }
 
+func (c Char) Evaluate(env *Environment) (Expression, error) {
+	return c, nil
+}
+
+func (c Char) String() string {
+	return Write(c)
+}
+
+// evaluate evaluates expr in env. The reader produces Go nil for nil, so
+// forms can hold nil where other expressions would be, and it evaluates to
+// itself.
+func evaluate(expr Expression, env *Environment) (Expression, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	return expr.Evaluate(env)
+}
+
+func (l List) String() string {
+	return Write(l)
+}
+
+// specialForms are the names List.Evaluate handles itself instead of
+// looking them up in the environment.
+var specialForms = []string{
+	"def", "defn", "func", "if", "+", "print", "fmt", "quote", "quasiquote",
+	"unquote", "defrecord", "deftype", "match", "defprotocol", "extend-type",
+	"defmulti", "defmethod", "defmacro", "do", "try", "and", "or", "not",
+	"-", "*", "/", "=", "<", ">", "<=", ">=",
+}
+
 func (l List) Evaluate(env *Environment) (Expression, error) {
 	if len(l) == 0 {
 		return nil, nil
 	}
+	if err := env.step(); err != nil {
+		return nil, err
+	}
 
 	// Macro expansion
 	expanded, didExpand, err := MacroExpand(l, env)
@@ -46,7 +124,7 @@ func (l List) Evaluate(env *Environment) (Expression, error) {
 	// If not a macro, proceed with normal evaluation
 	switch first := l[0].(type) {
 	case Name:
-		switch string(first) {
+		switch first.String() {
 		case "def":
 			return evalDef(l[1:], env)
 		case "defn":
@@ -59,28 +137,40 @@ func (l List) Evaluate(env *Environment) (Expression, error) {
 			return evalAdd(l[1:], env)
 		case "print":
 			return evalPrint(l[1:], env)
+		case "fmt":
+			return evalFmt(l[1:], env)
 		case "quote":
 			return evalQuote(l[1:], env)
 		case "quasiquote":
 			return evalQuasiquote(l[1:], env)
 		case "unquote":
 			return evalUnquote(l[1:], env)
+		case "defrecord":
+			return evalDefRecord(l[1:], env)
+		case "deftype":
+			return evalDefType(l[1:], env)
+		case "match":
+			return evalMatch(l[1:], env)
+		case "defprotocol":
+			return evalDefProtocol(l[1:], env)
+		case "extend-type":
+			return evalExtendType(l[1:], env)
+		case "defmulti":
+			return evalDefMulti(l[1:], env)
+		case "defmethod":
+			return evalDefMethod(l[1:], env)
 		case "defmacro":
 			return evalDefMacro(l[1:], env)
 		case "do":
 			return evalDo(l[1:], env)
+		case "try":
+			return evalTry(l[1:], env)
 		case "and":
 			return evalAnd(l[1:], env)
 		case "or":
 			return evalOr(l[1:], env)
 		case "not":
 			return evalNot(l[1:], env)
-		case "true":
-			return Boolean(true), nil
-		case "false":
-			return Boolean(false), nil
-		case "eval":
-			return evalEval(l[1:], env)
 		case "-":
 			return evalSubtract(l[1:], env)
 		case "*":
@@ -101,20 +191,32 @@ func (l List) Evaluate(env *Environment) (Expression, error) {
 	}
 
 	// Function call
-	fn, err := l[0].Evaluate(env)
+	fn, err := evaluate(l[0], env)
 	if err != nil {
 		return nil, err
 	}
-	if f, ok := fn.(*Function); ok {
-		// Evaluate arguments
-		args := make([]Expression, len(l)-1)
-		for i, arg := range l[1:] {
-			args[i], err = arg.Evaluate(env)
-			if err != nil {
-				return nil, err
-			}
+	args := make([]Expression, len(l)-1)
+	for i, arg := range l[1:] {
+		args[i], err = evaluate(arg, env)
+		if err != nil {
+			return nil, err
 		}
+	}
+	result, err := apply(fn, args, env)
+	if err != nil {
+		return nil, traceError(err, l)
+	}
+	return result, nil
+}
 
+// apply calls fn with already evaluated arguments.
+func apply(fn Expression, args []Expression, env *Environment) (Expression, error) {
+	switch f := fn.(type) {
+	case *Function:
+		if err := env.enter(); err != nil {
+			return nil, err
+		}
+		defer env.leave()
 		newEnv := NewEnvironment(f.env)
 		for i, param := range f.params {
 			if i < len(args) {
@@ -122,15 +224,45 @@ func (l List) Evaluate(env *Environment) (Expression, error) {
 			}
 		}
 		var result Expression
+		var err error
 		for _, expr := range f.body {
-			result, err = expr.Evaluate(newEnv)
+			result, err = evaluate(expr, newEnv)
 			if err != nil {
 				return nil, err
 			}
 		}
 		return result, nil
+	case *Builtin:
+		result, err := f.fn(args, env)
+		if err != nil {
+			return nil, err
+		}
+		if err := env.checkAlloc(result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	case *RecordType:
+		return f.New(args)
+	case *Variant:
+		return f.New(args)
+	case *ProtocolMethod:
+		return f.call(args, env)
+	case *MultiFn:
+		return f.call(args, env)
+	case *Keyword:
+		// (:key coll) and (:key coll default) look the keyword up.
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("keyword %v requires 1 or 2 arguments", f)
+		}
+		if value, ok := lookup(args[0], f); ok {
+			return value, nil
+		}
+		if len(args) == 2 {
+			return args[1], nil
+		}
+		return nil, nil
 	}
-	return nil, fmt.Errorf("not a function: %v", l[0])
+	return nil, fmt.Errorf("not a function: %v", fn)
 }
 
 // Define a new type to handle splicing
@@ -167,13 +299,13 @@ func quasiquoteExpand(expr Expression, env *Environment, depth int) (Expression,
 	case List:
 		if len(e) > 0 {
 			if name, ok := e[0].(Name); ok {
-				switch string(name) {
+				switch name.String() {
 				case "unquote-splicing":
 					if depth == 0 {
 						if len(e) != 2 {
 							return nil, fmt.Errorf("unquote-splicing requires exactly one argument")
 						}
-						spliced, err := e[1].Evaluate(env)
+						spliced, err := evaluate(e[1], env)
 						if err != nil {
 							return nil, err
 						}
@@ -222,7 +354,7 @@ func ExpandMacro(macro Macro, args []Expression, env *Environment) (Expression,
 		macroEnv.Set(param.(Name), args[i])
 	}
 
-	if macro.restParam != "" {
+	if macro.restParam != (Name{}) {
 		restArgs := args[len(macro.params):]
 		macroEnv.Set(macro.restParam, List(restArgs))
 	}
@@ -271,6 +403,7 @@ func MacroExpand(expr Expression, env *Environment) (Expression, bool, error) {
 }
 
 type Function struct {
+	name   Name
 	params List
 	body   List
 	env    *Environment
@@ -279,3 +412,160 @@ type Function struct {
 func (f *Function) Evaluate(env *Environment) (Expression, error) {
 	return f, nil
 }
+
+// Builtin is a primitive implemented in Go. Unlike special forms, its
+// arguments are evaluated before it is called.
+type Builtin struct {
+	name string
+	fn   func(args []Expression, env *Environment) (Expression, error)
+}
+
+func (b *Builtin) Evaluate(env *Environment) (Expression, error) {
+	return b, nil
+}
+
+func (b *Builtin) String() string {
+	return "#<builtin " + b.name + ">"
+}
+
+// records ---
+
+// RecordType is the type declared by (defrecord name field...). It is bound
+// to name and, when called, constructs a Record.
+type RecordType struct {
+	name   Name
+	fields []*Keyword
+}
+
+func (t *RecordType) Evaluate(env *Environment) (Expression, error) {
+	return t, nil
+}
+
+func (t *RecordType) String() string {
+	fields := make([]string, len(t.fields))
+	for i, field := range t.fields {
+		fields[i] = field.name
+	}
+	return fmt.Sprintf("#<record %v %s>", t.name, strings.Join(fields, " "))
+}
+
+func (t *RecordType) New(values []Expression) (*Record, error) {
+	if len(values) != len(t.fields) {
+		return nil, fmt.Errorf("%v requires %d arguments, got %d", t.name, len(t.fields), len(values))
+	}
+	return &Record{typ: t, values: append([]Expression(nil), values...)}, nil
+}
+
+func (t *RecordType) fieldIndex(key Expression) int {
+	for i, field := range t.fields {
+		if field == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Record is an immutable instance of a RecordType.
+type Record struct {
+	typ    *RecordType
+	values []Expression
+}
+
+func (r *Record) Evaluate(env *Environment) (Expression, error) {
+	return r, nil
+}
+
+func (r *Record) String() string {
+	return Write(r)
+}
+
+// Get returns the value of the field named by the keyword key.
+func (r *Record) Get(key Expression) (Expression, bool) {
+	if i := r.typ.fieldIndex(key); i >= 0 {
+		return r.values[i], true
+	}
+	return nil, false
+}
+
+// With returns a copy of r with the field named by key set to value.
+func (r *Record) With(key, value Expression) (*Record, error) {
+	i := r.typ.fieldIndex(key)
+	if i < 0 {
+		return nil, fmt.Errorf("%v has no field %v", r.typ.name, key)
+	}
+	values := append([]Expression(nil), r.values...)
+	values[i] = value
+	return &Record{typ: r.typ, values: values}, nil
+}
+
+// RecordLiteral is the reader's form of #point{:x 1 :y 2} and of a
+// variant written as #circle{:r 1}. Evaluating it looks up the record type
+// or variant and builds the value.
+type RecordLiteral struct {
+	name   Name
+	fields Map
+}
+
+func (r RecordLiteral) Evaluate(env *Environment) (Expression, error) {
+	evaluated, err := r.fields.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	return r.build(evaluated.(Map), env)
+}
+
+// build makes the record or variant the literal names from field values
+// that are already evaluated.
+func (r RecordLiteral) build(fields Map, env *Environment) (Expression, error) {
+	value, _ := env.Get(r.name)
+	switch t := value.(type) {
+	case *RecordType:
+		values, err := r.fieldValues(fields, t.fields)
+		if err != nil {
+			return nil, err
+		}
+		return t.New(values)
+	case *Variant:
+		values, err := r.fieldValues(fields, t.keywords())
+		if err != nil {
+			return nil, err
+		}
+		return t.New(values)
+	case *VariantValue:
+		if t.variant.bare {
+			_, err := r.fieldValues(fields, nil)
+			return t, err
+		}
+	}
+	return nil, fmt.Errorf("%v is not a record type or variant", r.name)
+}
+
+// fieldValues returns the values in fields of the keys, in order. Every
+// key must be given, and nothing else.
+func (r RecordLiteral) fieldValues(fields Map, keys []*Keyword) ([]Expression, error) {
+	var err error
+	fields.Each(func(k, v Expression) bool {
+		for _, key := range keys {
+			if k == Expression(key) {
+				return true
+			}
+		}
+		err = fmt.Errorf("%v has no field %s", r.name, Write(k))
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Expression, len(keys))
+	for i, key := range keys {
+		var ok bool
+		if values[i], ok = fields.Get(key); !ok {
+			return nil, fmt.Errorf("#%v{...} is missing field %v", r.name, key)
+		}
+	}
+	return values, nil
+}
+
+func (r RecordLiteral) String() string {
+	return Write(r)
+}
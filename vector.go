@@ -0,0 +1,155 @@
+package yocto
+
+import "fmt"
+
+// Vector is an immutable indexable sequence stored as a 32-way trie with
+// the last (partial) leaf kept in a separate tail, giving O(log32 n) Nth,
+// AssocN and Conj. The zero value is an empty vector.
+type Vector struct {
+	count int
+	shift uint
+	root  *vectorNode
+	tail  []Expression
+}
+
+type vectorNode struct {
+	nodes  []*vectorNode // interior nodes
+	values []Expression  // leaves
+}
+
+func NewVector(items ...Expression) Vector {
+	v := Vector{}
+	for _, item := range items {
+		v = v.Conj(item)
+	}
+	return v
+}
+
+// Evaluate evaluates every element, so [a (+ 1 2)] produces a vector of
+// values.
+func (v Vector) Evaluate(env *Environment) (Expression, error) {
+	result := Vector{}
+	for i := 0; i < v.count; i++ {
+		value, err := evaluate(v.Nth(i), env)
+		if err != nil {
+			return nil, err
+		}
+		result = result.Conj(value)
+	}
+	return result, nil
+}
+
+func (v Vector) String() string {
+	return Write(v)
+}
+
+func (v Vector) Count() int {
+	return v.count
+}
+
+func (v Vector) tailOffset() int {
+	if v.count < 32 {
+		return 0
+	}
+	return ((v.count - 1) >> 5) << 5
+}
+
+// Nth returns the element at i, which must be in range.
+func (v Vector) Nth(i int) Expression {
+	if i >= v.tailOffset() {
+		return v.tail[i-v.tailOffset()]
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= 5 {
+		node = node.nodes[(i>>level)&31]
+	}
+	return node.values[i&31]
+}
+
+// Conj returns a vector with x appended.
+func (v Vector) Conj(x Expression) Vector {
+	if v.root == nil {
+		v.root, v.shift = &vectorNode{}, 5
+	}
+	if v.count-v.tailOffset() < 32 {
+		tail := make([]Expression, len(v.tail), len(v.tail)+1)
+		copy(tail, v.tail)
+		return Vector{count: v.count + 1, shift: v.shift, root: v.root, tail: append(tail, x)}
+	}
+
+	// The tail is full: push it into the trie and start a new one.
+	tailNode := &vectorNode{values: v.tail}
+	root, shift := v.root, v.shift
+	if (v.count >> 5) > (1 << shift) {
+		root = &vectorNode{nodes: []*vectorNode{v.root, newVectorPath(shift, tailNode)}}
+		shift += 5
+	} else {
+		root = v.pushTail(shift, root, tailNode)
+	}
+	return Vector{count: v.count + 1, shift: shift, root: root, tail: []Expression{x}}
+}
+
+func (v Vector) pushTail(level uint, parent, tailNode *vectorNode) *vectorNode {
+	subidx := ((v.count - 1) >> level) & 31
+	ret := &vectorNode{nodes: append([]*vectorNode(nil), parent.nodes...)}
+	var child *vectorNode
+	switch {
+	case level == 5:
+		child = tailNode
+	case subidx < len(parent.nodes):
+		child = v.pushTail(level-5, parent.nodes[subidx], tailNode)
+	default:
+		child = newVectorPath(level-5, tailNode)
+	}
+	if subidx < len(ret.nodes) {
+		ret.nodes[subidx] = child
+	} else {
+		ret.nodes = append(ret.nodes, child)
+	}
+	return ret
+}
+
+func newVectorPath(level uint, node *vectorNode) *vectorNode {
+	if level == 0 {
+		return node
+	}
+	return &vectorNode{nodes: []*vectorNode{newVectorPath(level-5, node)}}
+}
+
+// AssocN returns a vector with the element at i replaced by x. An index
+// equal to Count appends.
+func (v Vector) AssocN(i int, x Expression) (Vector, error) {
+	if i == v.count {
+		return v.Conj(x), nil
+	}
+	if i < 0 || i > v.count {
+		return v, fmt.Errorf("index %d out of bounds for vector of length %d", i, v.count)
+	}
+	if i >= v.tailOffset() {
+		tail := append([]Expression(nil), v.tail...)
+		tail[i-v.tailOffset()] = x
+		return Vector{count: v.count, shift: v.shift, root: v.root, tail: tail}, nil
+	}
+	return Vector{count: v.count, shift: v.shift, root: assocVectorNode(v.shift, v.root, i, x), tail: v.tail}, nil
+}
+
+func assocVectorNode(level uint, node *vectorNode, i int, x Expression) *vectorNode {
+	if level == 0 {
+		values := append([]Expression(nil), node.values...)
+		values[i&31] = x
+		return &vectorNode{values: values}
+	}
+	nodes := append([]*vectorNode(nil), node.nodes...)
+	subidx := (i >> level) & 31
+	nodes[subidx] = assocVectorNode(level-5, nodes[subidx], i, x)
+	return &vectorNode{nodes: nodes}
+}
+
+// Items returns the elements as a fresh slice.
+func (v Vector) Items() []Expression {
+	items := make([]Expression, v.count)
+	for i := range items {
+		items[i] = v.Nth(i)
+	}
+	return items
+}
@@ -0,0 +1,48 @@
+package yocto
+
+import "testing"
+
+func TestVectorConjAndNth(t *testing.T) {
+	v := Vector{}
+	const n = 40000 // deep enough for a three-level trie
+	for i := 0; i < n; i++ {
+		v = v.Conj(Number(i))
+	}
+	if v.Count() != n {
+		t.Fatalf("Expected %d elements, got %d", n, v.Count())
+	}
+	for i := 0; i < n; i++ {
+		if got := v.Nth(i); got != Number(i) {
+			t.Fatalf("Nth(%d) = %v", i, got)
+		}
+	}
+}
+
+func TestVectorAssocN(t *testing.T) {
+	v := NewVector()
+	for i := 0; i < 2000; i++ {
+		v = v.Conj(Number(i))
+	}
+	updated := v
+	for i := 0; i < 2000; i += 7 {
+		var err error
+		if updated, err = updated.AssocN(i, String("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		if v.Nth(i) != Number(i) {
+			t.Fatalf("Original vector changed at %d", i)
+		}
+		want := Expression(Number(i))
+		if i%7 == 0 {
+			want = String("x")
+		}
+		if updated.Nth(i) != want {
+			t.Fatalf("Nth(%d) = %v, want %v", i, updated.Nth(i), want)
+		}
+	}
+	if _, err := v.AssocN(2001, Number(0)); err == nil {
+		t.Error("Expected out of bounds error")
+	}
+}